@@ -1,17 +1,30 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
 	"github.com/godzilla-s/k3s-installer/pkg/config"
 	"github.com/godzilla-s/k3s-installer/pkg/core"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 	"os"
 )
 
 var (
-	configFile string
+	configFile          string
+	insecureSkipHostKey bool
+	force               bool
+	secretsKey          string
+	profiles            []string
 )
 
+// secretsKeyEnv is used as secrets key if --secrets-key is not given
+const secretsKeyEnv = "K3S_INSTALLER_SECRETS_KEY"
+
 var rootCmd = &cobra.Command{}
 
 var installCmd = &cobra.Command{
@@ -19,10 +32,9 @@ var installCmd = &cobra.Command{
 	Use:   "install",
 	Run: func(cmd *cobra.Command, args []string) {
 		logger := newLogger("")
-		conf, err := config.Parse(configFile)
+		conf, err := parseConfig(logger)
 		if err != nil {
-			logger.Errorf("fail to parse config, error: %v", err)
-			return
+			os.Exit(1)
 		}
 
 		err = core.Install(conf, logger)
@@ -38,20 +50,172 @@ var uninstallCmd = &cobra.Command{
 	Use:   "uninstall",
 	Run: func(cmd *cobra.Command, args []string) {
 		logger := newLogger("")
-		conf, err := config.Parse(configFile)
+		conf, err := parseConfig(logger)
 		if err != nil {
-			logger.Errorf("fail to parse config, error: %v", err)
-			return
+			os.Exit(1)
 		}
 
 		err = core.Uninstall(conf, logger)
 		if err != nil {
-			logger.Errorf("install fail, error: %v", err)
+			logger.Errorf("uninstall fail, error: %v", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var checkNetworkCmd = &cobra.Command{
+	Short: "check the connectivity of k3s ports between nodes",
+	Use:   "check-network",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newLogger("")
+		conf, err := parseConfig(logger)
+		if err != nil {
+			os.Exit(1)
+		}
+
+		err = core.CheckConnectivity(conf, logger)
+		if err != nil {
+			logger.Errorf("check network fail, error: %v", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var validateCmd = &cobra.Command{
+	Short: "validate the config and the files it references without connecting to nodes",
+	Use:   "validate",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newLogger("")
+		conf, err := parseConfig(logger)
+		if err != nil {
+			os.Exit(1)
+		}
+		errs := core.Validate(conf)
+		for _, err := range errs {
+			logger.Errorf("invalid config: %v", err)
+		}
+		if len(errs) > 0 {
+			os.Exit(1)
+		}
+		logger.Infof("config is valid")
+	},
+}
+
+var renderCmd = &cobra.Command{
+	Short: "print the resolved config and the k3s config files written to every node",
+	Use:   "render",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newLogger("")
+		conf, err := parseConfig(logger)
+		if err != nil {
+			os.Exit(1)
+		}
+		err = core.Render(conf, os.Stdout)
+		if err != nil {
+			logger.Errorf("render fail, error: %v", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var schemaCmd = &cobra.Command{
+	Short: "print the JSON schema of config file",
+	Use:   "schema",
+	Run: func(cmd *cobra.Command, args []string) {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(config.JSONSchema()); err != nil {
+			newLogger("").Errorf("fail to print schema, error: %v", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var secretCmd = &cobra.Command{
+	Short: "manage the secrets in config",
+	Use:   "secret",
+}
+
+var secretEncryptCmd = &cobra.Command{
+	Short: "encrypt a secret with the secrets key, the secret is prompted on terminal or read from stdin",
+	Use:   "encrypt",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newLogger("")
+		key := getSecretsKey()
+		if key == "" {
+			logger.Errorf("missing secrets key, set --secrets-key or %s", secretsKeyEnv)
+			os.Exit(1)
+		}
+		secret, err := readSecret()
+		if err != nil {
+			logger.Errorf("fail to read secret, error: %v", err)
+			os.Exit(1)
+		}
+		encrypted, err := config.EncryptSecret(secret, key)
+		if err != nil {
+			logger.Errorf("fail to encrypt secret, error: %v", err)
 			os.Exit(1)
 		}
+		fmt.Println(encrypted)
 	},
 }
 
+// readSecret prompts the secret without echo on terminal, otherwise it reads stdin. The secret is
+// never taken from arguments since they are visible in shell history and ps.
+func readSecret() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "secret: ")
+		data, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(data), err
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func getSecretsKey() string {
+	if secretsKey != "" {
+		return secretsKey
+	}
+	return os.Getenv(secretsKeyEnv)
+}
+
+func parseOptions() []config.ParseOption {
+	return []config.ParseOption{config.WithSecretsKey(getSecretsKey()), config.WithProfiles(profiles...)}
+}
+
+// parseConfig parses the config file with the flags applied, the errors are logged one per line
+func parseConfig(logger *logrus.Logger) (*config.Config, error) {
+	conf, err := config.Parse(configFile, parseOptions()...)
+	if err != nil {
+		if errs, ok := err.(config.Errors); ok {
+			for _, e := range errs {
+				logger.Errorf("invalid config: %v", e)
+			}
+		} else {
+			logger.Errorf("fail to parse config, error: %v", err)
+		}
+		return nil, err
+	}
+	applyFlags(conf)
+	return conf, nil
+}
+
+func applyFlags(conf *config.Config) {
+	if insecureSkipHostKey {
+		conf.Settings.SSH.InsecureSkipHostKey = true
+	}
+	if force {
+		conf.Settings.Force = true
+	}
+}
+
 func newLogger(prefix string) *logrus.Logger {
 	// os.Mkdir(".log", )
 	return logrus.New()
@@ -59,8 +223,18 @@ func newLogger(prefix string) *logrus.Logger {
 
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "f", "", "config file")
+	rootCmd.PersistentFlags().BoolVar(&insecureSkipHostKey, "insecure-skip-host-key", false, "skip verifying host key of nodes")
+	rootCmd.PersistentFlags().StringSliceVar(&profiles, "profile", nil, "profiles merged on top of config in order")
+	rootCmd.PersistentFlags().StringVar(&secretsKey, "secrets-key", "", "key to decrypt the encrypted secrets in config, default $"+secretsKeyEnv)
+	installCmd.Flags().BoolVar(&force, "force", false, "continue installing even if preflight finds port or process conflicts")
 	rootCmd.AddCommand(installCmd)
 	rootCmd.AddCommand(uninstallCmd)
+	rootCmd.AddCommand(checkNetworkCmd)
+	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(renderCmd)
+	rootCmd.AddCommand(schemaCmd)
+	secretCmd.AddCommand(secretEncryptCmd)
+	rootCmd.AddCommand(secretCmd)
 }
 
 func main() {
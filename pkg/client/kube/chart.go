@@ -12,8 +12,9 @@ import (
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/release"
 
-	"helm.sh/helm/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/strvals"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/discovery/cached/disk"
@@ -32,11 +33,16 @@ type Chart struct {
 	ReleaseName     string
 	Namespace       string
 	CreateNamespace bool
-	ValuesFile      string
+	ValuesFiles     []string
+	Values          map[string]interface{}
 	After           string
 	Before          string
 	Timeout         time.Duration
-	SetValues       string
+	SetValues       []string
+	SetString       []string
+	SetFile         []string
+	// Source is where the chart is pulled from if PkgPath is not cached, nil for local chart
+	Source *ChartSource
 }
 
 type ReleaseChart struct {
@@ -88,9 +94,24 @@ func ToChart(c *config.Chart) *Chart {
 		PkgPath:     c.Path,
 		ReleaseName: c.ReleaseName,
 		Namespace:   c.Namespace,
-		ValuesFile:  filepath.Join(baseDir, "values.yaml"),
+		ValuesFiles: c.ValuesFiles,
+		Values:      c.Values,
+		SetValues:   c.SetValues,
+		SetString:   c.SetString,
+		SetFile:     c.SetFile,
 		Timeout:     c.Timeout,
 	}
+	if c.Repo != "" {
+		ch.Source = &ChartSource{
+			Repo:                  c.Repo,
+			Chart:                 c.Chart,
+			Version:               c.Version,
+			Username:              c.Username,
+			Password:              c.Password,
+			CaFile:                c.CaFile,
+			InsecureSkipTLSVerify: c.InsecureSkipTLSVerify,
+		}
+	}
 	if ch.Timeout == 0 {
 		ch.Timeout = 1 * time.Minute
 	}
@@ -105,6 +126,61 @@ func ToChart(c *config.Chart) *Chart {
 	return ch
 }
 
+// mergeValues merges the values with the precedence of helm, values files are merged in order,
+// then the inline values, --set, --set-string and --set-file override them
+func (c *Chart) mergeValues() (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	for _, file := range c.ValuesFiles {
+		fileValues, err := chartutil.ReadValuesFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("fail to read values file %s: %v", file, err)
+		}
+		values = mergeMaps(values, fileValues)
+	}
+	values = mergeMaps(values, c.Values)
+
+	for _, value := range c.SetValues {
+		if err := strvals.ParseInto(value, values); err != nil {
+			return nil, fmt.Errorf("invalid setValues '%s': %v", value, err)
+		}
+	}
+	for _, value := range c.SetString {
+		if err := strvals.ParseIntoString(value, values); err != nil {
+			return nil, fmt.Errorf("invalid setString '%s': %v", value, err)
+		}
+	}
+	readFile := func(rs []rune) (interface{}, error) {
+		data, err := os.ReadFile(string(rs))
+		return string(data), err
+	}
+	for _, value := range c.SetFile {
+		if err := strvals.ParseIntoFile(value, values, readFile); err != nil {
+			return nil, fmt.Errorf("invalid setFile '%s': %v", value, err)
+		}
+	}
+	return values, nil
+}
+
+// mergeMaps merges b into a recursively, the values of b win
+func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		if v, ok := v.(map[string]interface{}); ok {
+			if bv, ok := out[k]; ok {
+				if bv, ok := bv.(map[string]interface{}); ok {
+					out[k] = mergeMaps(bv, v)
+					continue
+				}
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
 func (cli *ChartClient) newActionConfig(namespace string) (*action.Configuration, error) {
 	actionConfig := new(action.Configuration)
 	restGetter := &restClientGetter{
@@ -132,7 +208,7 @@ func (cli *ChartClient) Install(c *Chart) error {
 	install.Timeout = c.Timeout
 	install.CreateNamespace = true
 
-	values, err := chartutil.ReadValuesFile(c.ValuesFile)
+	values, err := c.mergeValues()
 	if err != nil {
 		return err
 	}
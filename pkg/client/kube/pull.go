@@ -0,0 +1,99 @@
+package kube
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/registry"
+)
+
+// ChartSource is a helm repository or an oci registry where the chart is pulled from
+type ChartSource struct {
+	Repo                  string
+	Chart                 string
+	Version               string
+	Username              string
+	Password              string
+	CaFile                string
+	InsecureSkipTLSVerify bool
+}
+
+// PullChart downloads the chart to cacheFile if it is not cached yet, so the next run can work
+// without network. The index of helm repository and the registry credentials are kept in workDir.
+func PullChart(src *ChartSource, cacheFile, workDir string) error {
+	if _, err := os.Stat(cacheFile); err == nil {
+		return nil
+	}
+
+	settings := cli.New()
+	settings.RepositoryCache = filepath.Join(workDir, "repository")
+	settings.RepositoryConfig = filepath.Join(workDir, "repositories.yaml")
+	settings.RegistryConfig = filepath.Join(workDir, "registry.json")
+
+	registryClient, err := registry.NewRegistryClientWithTLS(io.Discard, "", "", src.CaFile,
+		src.InsecureSkipTLSVerify, settings.RegistryConfig, false)
+	if err != nil {
+		return err
+	}
+
+	chartRef := src.Chart
+	isOCI := registry.IsOCI(src.Repo)
+	if isOCI {
+		chartRef = strings.TrimSuffix(src.Repo, "/") + "/" + src.Chart
+		if src.Username != "" {
+			u, err := url.Parse(src.Repo)
+			if err != nil {
+				return err
+			}
+			err = registryClient.Login(u.Host,
+				registry.LoginOptBasicAuth(src.Username, src.Password),
+				registry.LoginOptInsecure(src.InsecureSkipTLSVerify),
+				registry.LoginOptTLSClientConfig("", "", src.CaFile))
+			if err != nil {
+				return fmt.Errorf("fail to login %s: %v", u.Host, err)
+			}
+		}
+	}
+
+	err = os.MkdirAll(filepath.Dir(cacheFile), 0755)
+	if err != nil {
+		return err
+	}
+	// pull into a temporary directory, a broken download never takes the place of cache
+	tmpDir, err := os.MkdirTemp(filepath.Dir(cacheFile), ".pull-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	pull := action.NewPullWithOpts(action.WithConfig(&action.Configuration{RegistryClient: registryClient}))
+	pull.Settings = settings
+	pull.Version = src.Version
+	pull.Username = src.Username
+	pull.Password = src.Password
+	pull.CaFile = src.CaFile
+	pull.InsecureSkipTLSverify = src.InsecureSkipTLSVerify
+	pull.DestDir = tmpDir
+	if !isOCI {
+		pull.RepoURL = src.Repo
+	}
+	_, err = pull.Run(chartRef)
+	if err != nil {
+		return fmt.Errorf("fail to pull chart %s from %s: %v", src.Chart, src.Repo, err)
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		return err
+	}
+	if len(entries) != 1 {
+		return fmt.Errorf("fail to pull chart %s from %s: unexpected %d files downloaded", src.Chart, src.Repo, len(entries))
+	}
+	return os.Rename(filepath.Join(tmpDir, entries[0].Name()), cacheFile)
+}
@@ -0,0 +1,89 @@
+package remote
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func authMethods(conf *Config, agentClient agent.Agent) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+	if conf.PrivateKey != "" {
+		signer, err := loadPrivateKey(conf.PrivateKey, conf.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+
+	if conf.UseAgent && agentClient != nil {
+		methods = append(methods, ssh.PublicKeysCallback(agentClient.Signers))
+	}
+
+	// password is only used as the last choice
+	if conf.Password != "" {
+		methods = append(methods, ssh.Password(conf.Password))
+	}
+
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no ssh auth method configured")
+	}
+	return methods, nil
+}
+
+func loadPrivateKey(keyFile, passphrase string) (ssh.Signer, error) {
+	keyFile, err := expandHome(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read private key fail: %v", err)
+	}
+	if passphrase != "" {
+		signer, err := ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("parse private key %s fail: %v", keyFile, err)
+		}
+		return signer, nil
+	}
+
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		if _, ok := err.(*ssh.PassphraseMissingError); ok {
+			return nil, fmt.Errorf("private key %s is encrypted, missing passphrase", keyFile)
+		}
+		return nil, fmt.Errorf("parse private key %s fail: %v", keyFile, err)
+	}
+	return signer, nil
+}
+
+// usesAgent reports whether the node or any of its bastions authenticates by ssh agent
+func usesAgent(conf *Config) bool {
+	if conf.UseAgent {
+		return true
+	}
+	for _, bastion := range conf.Bastions {
+		if usesAgent(bastion) {
+			return true
+		}
+	}
+	return false
+}
+
+// dialAgent connects the ssh agent, the connection is shared by all the hops of a client and
+// closed with the client
+func dialAgent() (net.Conn, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, fmt.Errorf("ssh agent not available: SSH_AUTH_SOCK not set")
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, fmt.Errorf("connect ssh agent fail: %v", err)
+	}
+	return conn, nil
+}
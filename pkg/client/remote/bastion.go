@@ -0,0 +1,77 @@
+package remote
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+type hop struct {
+	address string
+	auth    *ssh.ClientConfig
+}
+
+func newClientConfig(conf *Config, agentClient agent.Agent) (*ssh.ClientConfig, error) {
+	methods, err := authMethods(conf, agentClient)
+	if err != nil {
+		return nil, err
+	}
+	if conf.User == "" {
+		conf.User = "root"
+	}
+	auth := &ssh.ClientConfig{
+		User:              conf.User,
+		Auth:              methods,
+		HostKeyCallback:   hostKeyCallback(conf.HostKey),
+		HostKeyAlgorithms: hostKeyAlgorithms(conf.HostKey, conf.Address),
+		Timeout:           conf.Timeout,
+	}
+	if auth.Timeout == 0 {
+		auth.Timeout = 15 * time.Second
+	}
+	return auth, nil
+}
+
+// dialHops connects the last hop through the previous hops like ProxyJump, it returns
+// the client of last hop and the clients of jump hosts, which should be closed after it
+func dialHops(hops []hop) (*ssh.Client, []*ssh.Client, error) {
+	var jumps []*ssh.Client
+	closeJumps := func() {
+		for i := len(jumps) - 1; i >= 0; i-- {
+			jumps[i].Close()
+		}
+	}
+
+	var client *ssh.Client
+	for i, h := range hops {
+		if i == 0 {
+			c, err := ssh.Dial("tcp", h.address, h.auth)
+			if err != nil {
+				return nil, nil, err
+			}
+			client = c
+			continue
+		}
+
+		jumps = append(jumps, client)
+		conn, err := client.Dial("tcp", h.address)
+		if err != nil {
+			closeJumps()
+			return nil, nil, fmt.Errorf("dial %s through jump host fail: %v", h.address, err)
+		}
+		if h.auth.Timeout > 0 {
+			_ = conn.SetDeadline(time.Now().Add(h.auth.Timeout))
+		}
+		sshConn, chans, reqs, err := ssh.NewClientConn(conn, h.address, h.auth)
+		if err != nil {
+			conn.Close()
+			closeJumps()
+			return nil, nil, fmt.Errorf("ssh handshake with %s fail: %v", h.address, err)
+		}
+		_ = conn.SetDeadline(time.Time{})
+		client = ssh.NewClient(sshConn, chans, reqs)
+	}
+	return client, jumps, nil
+}
@@ -2,9 +2,13 @@ package remote
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/pkg/sftp"
 )
 
 type centosClient struct {
@@ -12,7 +16,12 @@ type centosClient struct {
 }
 
 func (c *centosClient) Install(pkgDir string) error {
-	entries, err := c.sftp.ReadDir(pkgDir)
+	var entries []os.FileInfo
+	err := c.withSFTP(func(cli *sftp.Client) error {
+		var err error
+		entries, err = cli.ReadDir(pkgDir)
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -48,10 +57,6 @@ func (c *centosClient) Uninstall(pkgs []string) error {
 	return c.uninstall(installedRPMs)
 }
 
-func (c *centosClient) StopFirewall() error {
-	return nil
-}
-
 func (c *centosClient) install(rpms []string) error {
 	var installingRPMs []string
 	for _, rpm := range rpms {
@@ -67,48 +72,20 @@ func (c *centosClient) install(rpms []string) error {
 		return nil
 	}
 	cmd := fmt.Sprintf("yum localinstall -y %s", strings.Join(rpms, " "))
-	// fmt.Println("=====> command:", cmd)
-	output, err := c.execCommand(cmd)
-	if err != nil {
-		for _, line := range bytes.Split(output, []byte("\n")) {
-			c.log.Errorln(string(line))
-		}
-		return err
-	}
-	for _, line := range bytes.Split(output, []byte("\n")) {
-		c.log.Println(string(line))
-	}
-	return nil
+	_, err = c.Exec(context.Background(), cmd, WithTimeout(installTimeout))
+	return err
 }
 
 func (c *centosClient) uninstall(rpms []string) error {
-	cmd := fmt.Sprintf("yum remove %s", strings.Join(rpms, " "))
-	output, err := c.execCommand(cmd)
-	if err != nil {
-		for _, line := range bytes.Split(output, []byte("\n")) {
-			c.log.Errorln(string(line))
-		}
-		return err
-	}
-	for _, line := range bytes.Split(output, []byte("\n")) {
-		c.log.Println(string(line))
-	}
-	return nil
+	cmd := fmt.Sprintf("yum remove -y %s", strings.Join(rpms, " "))
+	_, err := c.Exec(context.Background(), cmd, WithTimeout(installTimeout))
+	return err
 }
 
 func (c *centosClient) update(rpms []string) error {
-	cmd := fmt.Sprintf("yum update %s", strings.Join(rpms, " "))
-	output, err := c.execCommand(cmd)
-	if err != nil {
-		for _, line := range bytes.Split(output, []byte("\n")) {
-			c.log.Errorln(string(line))
-		}
-		return err
-	}
-	for _, line := range bytes.Split(output, []byte("\n")) {
-		c.log.Println(string(line))
-	}
-	return nil
+	cmd := fmt.Sprintf("yum update -y %s", strings.Join(rpms, " "))
+	_, err := c.Exec(context.Background(), cmd, WithTimeout(installTimeout))
+	return err
 }
 
 func (c *centosClient) listInstalled(rpms []string) ([]string, error) {
@@ -2,120 +2,168 @@ package remote
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/godzilla-s/k3s-installer/pkg/utils"
 	"github.com/pkg/sftp"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const (
+	serviceTimeout = 2 * time.Minute
+	installTimeout = 10 * time.Minute
 )
 
 type Client struct {
-	address string
-	ssh     *ssh.Client
-	sftp    *sftp.Client
-	auth    *ssh.ClientConfig
-	log     *logrus.Entry
+	address        string
+	jumps          []hop
+	jumpClients    []*ssh.Client
+	ssh            *ssh.Client
+	sftp           *sftp.Client
+	auth           *ssh.ClientConfig
+	log            *logrus.Entry
+	become         bool
+	becomePassword string
+	sudoNoPassword bool
+	stagingDir     string
+	loginUID       uint64
+	// agentConn is the connection to ssh agent, it is kept for reconnecting
+	agentConn     net.Conn
+	mux           sync.RWMutex
+	closed        bool
+	stopKeepAlive chan struct{}
+	release       *OSRelease
 	SystemAction
 }
 
 type SystemInfo struct {
-	NumberCPU     int
-	Memory        utils.Capacity // Gi
+	NumberCPU int
+	Memory    utils.Capacity
+	// Storage is the free space of k3s data directory
 	Storage       utils.Capacity
 	Hostname      string
 	KernelVersion utils.KernelVersion
+	OS            OSRelease
+	Arch          string
 }
 
 type Config struct {
-	Address  string
-	User     string
-	Password string
-	Timeout  time.Duration
+	Address    string
+	User       string
+	Password   string
+	PrivateKey string
+	Passphrase string
+	UseAgent   bool
+	// Become runs commands and writes files with sudo when User is not root
+	Become         bool
+	BecomePassword string
+	HostKey        *HostKeyConfig
+	// Bastions are the jump hosts in order to reach Address
+	Bastions []*Config
+	// OS is checked against the os detected from node if it is given
+	OS      string
+	Timeout time.Duration
 }
 type SystemAction interface {
 	Install(object string) error
 	Uninstall(objects []string) error
-	StopFirewall() error
 }
 
-type CommandOption func(*ssh.Session)
-
 func New(conf *Config, log *logrus.Entry) (*Client, error) {
-	auth := &ssh.ClientConfig{
-		User: "root",
-		Auth: []ssh.AuthMethod{
-			ssh.Password(conf.Password),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         conf.Timeout,
-	}
-	if auth.Timeout == 0 {
-		auth.Timeout = 15 * time.Second
+	client := &Client{
+		address:        conf.Address,
+		log:            log,
+		become:         conf.Become && conf.User != "root",
+		becomePassword: conf.BecomePassword,
 	}
 
-	client := &Client{
-		address: conf.Address,
-		auth:    auth,
-		log:     log,
+	var agentClient agent.Agent
+	if usesAgent(conf) {
+		conn, err := dialAgent()
+		if err != nil {
+			return nil, err
+		}
+		client.agentConn = conn
+		agentClient = agent.NewClient(conn)
 	}
 
-	err := client.connect()
+	auth, err := newClientConfig(conf, agentClient)
 	if err != nil {
+		client.Close()
 		return nil, err
 	}
-	return client, nil
-}
+	client.auth = auth
+	for _, bastion := range conf.Bastions {
+		bastionAuth, err := newClientConfig(bastion, agentClient)
+		if err != nil {
+			client.Close()
+			return nil, fmt.Errorf("invalid bastion %s: %v", bastion.Address, err)
+		}
+		client.jumps = append(client.jumps, hop{address: bastion.Address, auth: bastionAuth})
+	}
 
-func (c *Client) connect() error {
-	sshClient, err := ssh.Dial("tcp", c.address, c.auth)
+	err = client.connect()
 	if err != nil {
-		return err
+		client.Close()
+		return nil, err
 	}
-	sftpClient, err := sftp.NewClient(sshClient)
+	err = client.detectOS(conf.OS)
 	if err != nil {
-		return err
+		client.Close()
+		return nil, err
 	}
-	c.ssh = sshClient
-	c.sftp = sftpClient
-	c.SystemAction = &centosClient{Client: c}
-	return nil
+	return client, nil
 }
 
-func (c *Client) execCommand(cmd string, options ...CommandOption) ([]byte, error) {
-	if c.ssh == nil {
-		return nil, fmt.Errorf("ssh client not init")
+// dataDir is where k3s keeps its data, the storage requirement is checked against it
+const dataDir = "/var/lib/rancher"
+
+func (c *Client) GetSystemInfo() (*SystemInfo, error) {
+	// get cpu core number
+	output, err := c.execCommand("nproc")
+	if err != nil {
+		return nil, err
 	}
-	sess, err := c.ssh.NewSession()
+	cpuNumber, err := strconv.ParseInt(string(bytes.TrimSpace(output)), 0, 10)
 	if err != nil {
 		return nil, err
 	}
 
-	return sess.CombinedOutput(cmd)
-}
-
-func (c *Client) GetSystemInfo() (*SystemInfo, error) {
-	// get cpu core number
-	cmd := "cat /proc/cpuinfo |grep processor |wc -l"
-	output, err := c.execCommand(cmd)
+	output, err = c.execCommand(`awk '/^MemTotal:/{print $2}' /proc/meminfo`)
 	if err != nil {
 		return nil, err
 	}
-	cpuNumber, err := strconv.ParseInt(string(bytes.TrimRight(output, "\n")), 0, 10)
+	memoryKB, err := strconv.ParseInt(string(bytes.TrimSpace(output)), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid memory size '%s'", bytes.TrimSpace(output))
+	}
+
+	// the data directory may not exist before k3s installed, check the nearest existing parent
+	cmd := fmt.Sprintf(`d=%s; while [ ! -d "$d" ]; do d=$(dirname "$d"); done; df -Pk "$d" | awk 'NR==2{print $4}'`, dataDir)
+	output, err = c.execCommand(cmd)
 	if err != nil {
 		return nil, err
 	}
+	storageKB, err := strconv.ParseInt(string(bytes.TrimSpace(output)), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid free storage size '%s'", bytes.TrimSpace(output))
+	}
 
-	output, err = c.execCommand(`free -h | awk 'NR==2{print $2}'`)
+	output, err = c.execCommand("uname -r")
 	if err != nil {
 		return nil, err
 	}
-	memorySize, err := utils.ParseCapacity(string(bytes.TrimRight(output, "\n")))
+	kernelVersion, err := utils.ParseKernelVersion(string(output))
 	if err != nil {
 		return nil, err
 	}
@@ -125,25 +173,35 @@ func (c *Client) GetSystemInfo() (*SystemInfo, error) {
 		return nil, err
 	}
 	hostname := string(bytes.TrimRight(output, "\n"))
+
+	output, err = c.execCommand("uname -m")
+	if err != nil {
+		return nil, err
+	}
 	return &SystemInfo{
-		NumberCPU: int(cpuNumber),
-		Memory:    memorySize,
-		Hostname:  hostname,
+		NumberCPU:     int(cpuNumber),
+		Memory:        utils.NewCapacity(memoryKB * 1024),
+		Storage:       utils.NewCapacity(storageKB * 1024),
+		Hostname:      hostname,
+		KernelVersion: kernelVersion,
+		OS:            *c.release,
+		Arch:          normalizeArch(string(bytes.TrimSpace(output))),
 	}, nil
 }
 
-func (c *Client) WriteFile(file string, data []byte, override bool) error {
+// WriteFile writes data to file with mode, the mode is applied before data is written
+func (c *Client) WriteFile(file string, data []byte, mode os.FileMode, override bool) error {
 	if !override {
-		_, err := c.sftp.Stat(file)
+		_, err := c.stat(file)
 		if err == nil {
 			return ErrFileExist
 		}
 	}
 
 	baseDir := filepath.Dir(file)
-	fi, err := c.sftp.Stat(baseDir)
+	fi, err := c.stat(baseDir)
 	if err != nil {
-		err = c.sftp.MkdirAll(baseDir)
+		err = c.mkdirAll(baseDir)
 		if err != nil {
 			return err
 		}
@@ -153,27 +211,54 @@ func (c *Client) WriteFile(file string, data []byte, override bool) error {
 		}
 	}
 
-	f, err := c.sftp.Create(file)
+	staging := c.stagingPath(file)
+	err = c.withSFTP(func(cli *sftp.Client) error {
+		f, err := cli.Create(staging)
+		if err != nil {
+			return err
+		}
+		// chmod an existing file as well, it is kept by create
+		if err = f.Chmod(mode); err != nil {
+			f.Close()
+			return err
+		}
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	})
 	if err != nil {
 		return err
 	}
-
-	_, err = f.Write(data)
-	return err
+	return c.installFile(staging, file, mode)
 }
 
 func (c *Client) ReadFile(file string) ([]byte, error) {
-	err := c.connect()
-	if err != nil {
-		fmt.Println("connect fail:", err)
-		return nil, err
-	}
-	f, err := c.sftp.Open(file)
-	if err != nil {
-		return nil, err
-	}
-	defer c.sftp.Close()
-	data, err := io.ReadAll(f)
+	if c.become {
+		// the output of sudo carries its warnings, the file is copied to staging directory and
+		// read by sftp instead
+		staging := c.stagingPath(file) + ".read"
+		if err := c.exportFile(file, staging); err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = c.withSFTP(func(cli *sftp.Client) error {
+				return cli.Remove(staging)
+			})
+		}()
+		file = staging
+	}
+	var data []byte
+	err := c.withSFTP(func(cli *sftp.Client) error {
+		f, err := cli.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		data, err = io.ReadAll(f)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -219,63 +304,88 @@ func (c *Client) Copy(local, target string, override bool) error {
 	return nil
 }
 
+// CopyFile uploads local to target, it is skipped if the remote file has the same sha256.
+// The file is uploaded to a part file first, which is resumed if the upload is interrupted
+// and renamed to target when the checksum is verified.
 func (c *Client) CopyFile(local, target string, override bool) error {
-	fr, err := os.Open(local)
+	fri, err := os.Stat(local)
+	if err != nil {
+		c.log.Printf("fail to read local file, file: %s, error: %v", local, err)
+		return err
+	}
+	sum, err := fileSHA256(local, fri)
 	if err != nil {
 		c.log.Printf("fail to read local file, file: %s, error: %v", local, err)
 		return err
 	}
-	fri, _ := fr.Stat()
-	defer fr.Close()
-	fi, err := c.sftp.Stat(target)
+
+	fi, err := c.stat(target)
 	if err == nil {
 		if fi.IsDir() {
 			return fmt.Errorf("target is a directory")
 		}
-		if !override {
+		if fi.Size() == fri.Size() {
+			remoteSum, err := c.remoteSHA256(target)
+			if err != nil {
+				c.log.Warnf("fail to checksum remote file, target: %s, error: %v", target, err)
+			} else if remoteSum == sum {
+				c.log.Printf("remote file is identical, skip copying, target: %s", target)
+				return nil
+			}
+		}
+		// a smaller remote file is an interrupted copy, it is always replaced
+		if !override && fi.Size() >= fri.Size() {
+			c.log.Warnf("remote file is different from local, keep it, target: %s", target)
 			return ErrFileExist
 		}
-		fw, err := c.sftp.OpenFile(target, os.O_CREATE|os.O_RDWR)
+	} else {
+		baseDir := filepath.Dir(target)
+		_, err = c.stat(baseDir)
 		if err != nil {
-			return fmt.Errorf("open or create file fail: %v", err)
+			err = c.mkdirAll(baseDir)
+			if err != nil {
+				c.log.Errorf("fail to create base directory, dir: %s", baseDir)
+				return err
+			}
 		}
-		defer fw.Close()
-		_, err = io.Copy(fw, fr)
+	}
+
+	part := c.stagingPath(target) + partSuffix
+	for i := 0; ; i++ {
+		err = c.withSFTP(func(cli *sftp.Client) error {
+			return c.upload(cli, local, part, fri.Size())
+		})
 		if err != nil {
-			return fmt.Errorf("copy fail: %v", err)
+			c.log.Errorf("copy file fail, local: %s, target:%s, error: %v", local, target, err)
+			return err
 		}
-		c.sftp.Chmod(target, fri.Mode())
-		return nil
-	}
-	baseDir := filepath.Dir(target)
-	// fmt.Println("baseDir:", baseDir)
-	fi, err = c.sftp.Stat(baseDir)
-	if err != nil {
-		err = c.sftp.MkdirAll(baseDir)
+		remoteSum, err := c.remoteSHA256(part)
 		if err != nil {
-			c.log.Errorf("fail to create base directory, dir: %s", baseDir)
 			return err
 		}
+		if remoteSum == sum {
+			break
+		}
+		_ = c.withSFTP(func(cli *sftp.Client) error {
+			return cli.Remove(part)
+		})
+		if i > 0 {
+			return fmt.Errorf("checksum mismatch after copying %s to %s", local, target)
+		}
+		c.log.Warnf("checksum mismatch, copy again, target: %s", target)
 	}
 
-	fw, err := c.sftp.OpenFile(target, os.O_CREATE|os.O_RDWR)
-	if err != nil {
-		c.log.Errorf("fail to create or open fail, file: %s, err: %v", target, err)
-		return err
-	}
-	defer fw.Close()
-	_, err = io.Copy(fw, fr)
+	err = c.commit(part, target, fri.Mode())
 	if err != nil {
-		c.log.Errorf("copy file fail, local: %s, target:%s, error: %v", local, target, err)
+		c.log.Errorf("fail to install file, target: %s, error: %v", target, err)
 		return err
 	}
-	c.sftp.Chmod(target, fri.Mode())
 	c.log.Printf("copy file success, local: %s, target: %s", local, target)
 	return nil
 }
 
 func (c *Client) Remove(target string) error {
-	fi, err := c.sftp.Stat(target)
+	fi, err := c.stat(target)
 	if err != nil {
 		return err
 	}
@@ -285,14 +395,15 @@ func (c *Client) Remove(target string) error {
 			c.log.Errorf("remove direcotry fail, dir: %s, error: %v, message: %s", target, err, output)
 			return err
 		}
-		c.log.Panicf("remove directory successful")
+		c.log.Printf("remove directory successful")
+		return nil
 	}
 	output, err := c.execCommand(fmt.Sprintf("rm -f %s", target))
 	if err != nil {
 		c.log.Errorf("remove file fail, file: %s, error: %v, message: %s", target, err, output)
 		return err
 	}
-	c.log.Panicf("remove file successful")
+	c.log.Printf("remove file successful")
 	return nil
 }
 
@@ -302,12 +413,8 @@ func (c *Client) StartK3S(isMaster bool) error {
 		cmd = "systemctl restart k3s-agent"
 	}
 
-	output, err := c.execCommand(cmd)
-	if err != nil {
-		return err
-	}
-	fmt.Println(string(output))
-	return nil
+	_, err := c.Exec(context.Background(), cmd, WithTimeout(serviceTimeout))
+	return err
 }
 
 func (c *Client) RestartK3S(isMaster bool) error {
@@ -315,17 +422,8 @@ func (c *Client) RestartK3S(isMaster bool) error {
 	if !isMaster {
 		cmd = "systemctl restart k3s-agent"
 	}
-	output, err := c.execCommand(cmd)
-	if err != nil {
-		for _, line := range bytes.Split(output, []byte("\n")) {
-			c.log.Errorln(string(line))
-		}
-		return err
-	}
-	for _, line := range bytes.Split(output, []byte("\n")) {
-		c.log.Println(string(line))
-	}
-	return nil
+	_, err := c.Exec(context.Background(), cmd, WithTimeout(serviceTimeout))
+	return err
 }
 
 func (c *Client) IsK3SRunning(isMaster bool) error {
@@ -333,7 +431,7 @@ func (c *Client) IsK3SRunning(isMaster bool) error {
 	if !isMaster {
 		cmd = "systemctl is-active k3s-agent"
 	}
-	output, _ := c.execCommand(cmd)
+	output, _ := c.execCommand(cmd, WithTimeout(serviceTimeout))
 	status := string(bytes.TrimRight(output, "\n"))
 	c.log.Printf("k3s status: %s", status)
 	switch status {
@@ -347,21 +445,15 @@ func (c *Client) IsK3SRunning(isMaster bool) error {
 }
 
 func (c *Client) InstallK3S(isMaster bool) error {
-	cmd := "INSTALL_K3S_SKIP_DOWNLOAD=true install.sh"
-	if !isMaster {
-		cmd = "INSTALL_K3S_SKIP_DOWNLOAD=true INSTALL_K3S_EXEC=agent install.sh"
+	options := []CommandOption{
+		WithEnv("INSTALL_K3S_SKIP_DOWNLOAD", "true"),
+		WithTimeout(installTimeout),
 	}
-	output, err := c.execCommand(cmd)
-	if err != nil {
-		for _, line := range bytes.Split(output, []byte("\n")) {
-			c.log.Errorln(string(line))
-		}
-		return err
-	}
-	for _, line := range bytes.Split(output, []byte("\n")) {
-		c.log.Println(string(line))
+	if !isMaster {
+		options = append(options, WithEnv("INSTALL_K3S_EXEC", "agent"))
 	}
-	return nil
+	_, err := c.Exec(context.Background(), "install.sh", options...)
+	return err
 }
 
 func (c *Client) UninstallK3S(isMaster bool) error {
@@ -370,15 +462,6 @@ func (c *Client) UninstallK3S(isMaster bool) error {
 		cmd = "k3s-agent-uninstall.sh"
 	}
 
-	output, err := c.execCommand(cmd)
-	if err != nil {
-		for _, line := range bytes.Split(output, []byte("\n")) {
-			c.log.Errorln(string(line))
-		}
-		return err
-	}
-	for _, line := range bytes.Split(output, []byte("\n")) {
-		c.log.Println(string(line))
-	}
-	return nil
+	_, err := c.Exec(context.Background(), cmd, WithTimeout(installTimeout))
+	return err
 }
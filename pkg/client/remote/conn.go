@@ -0,0 +1,234 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultKeepAlive = 30 * time.Second
+	keepAliveTimeout = 15 * time.Second
+	maxReconnect     = 3
+)
+
+func (c *Client) connect() error {
+	hops := append(append([]hop{}, c.jumps...), hop{address: c.address, auth: c.auth})
+	sshClient, jumpClients, err := dialHops(hops)
+	if err != nil {
+		return err
+	}
+	sftpClient, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		for _, jc := range jumpClients {
+			jc.Close()
+		}
+		return err
+	}
+	if c.become {
+		err = c.prepareBecome(sshClient, sftpClient)
+		if err != nil {
+			sftpClient.Close()
+			sshClient.Close()
+			for _, jc := range jumpClients {
+				jc.Close()
+			}
+			return err
+		}
+	}
+	c.ssh = sshClient
+	c.sftp = sftpClient
+	c.jumpClients = jumpClients
+	c.stopKeepAlive = make(chan struct{})
+	go c.keepAlive(sshClient, c.stopKeepAlive)
+	return nil
+}
+
+// disconnect closes the current connection, it must be called with mux held
+func (c *Client) disconnect() {
+	if c.stopKeepAlive != nil {
+		close(c.stopKeepAlive)
+		c.stopKeepAlive = nil
+	}
+	if c.sftp != nil {
+		c.sftp.Close()
+		c.sftp = nil
+	}
+	if c.ssh != nil {
+		c.ssh.Close()
+		c.ssh = nil
+	}
+	for i := len(c.jumpClients) - 1; i >= 0; i-- {
+		c.jumpClients[i].Close()
+	}
+	c.jumpClients = nil
+}
+
+// keepAlive closes the connection when the remote stops answering, so the next
+// operation gets a connection error and reconnects instead of hanging
+func (c *Client) keepAlive(client *ssh.Client, stop chan struct{}) {
+	ticker := time.NewTicker(defaultKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			// the request blocks forever on a half-open connection, wait for the reply in time
+			result := make(chan error, 1)
+			go func() {
+				_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+				result <- err
+			}()
+			var err error
+			select {
+			case err = <-result:
+			case <-time.After(keepAliveTimeout):
+				err = fmt.Errorf("no reply in %s", keepAliveTimeout)
+			case <-stop:
+				return
+			}
+			if err != nil {
+				c.log.Warnf("ssh keepalive fail, error: %v", err)
+				client.Close()
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) reconnect(broken *ssh.Client) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.closed {
+		return ErrClientClosed
+	}
+	// another caller has reconnected already
+	if c.ssh != nil && c.ssh != broken {
+		return nil
+	}
+	c.disconnect()
+	c.log.Warnf("connection to %s lost, reconnecting", c.address)
+	return c.connect()
+}
+
+func (c *Client) clients() (*ssh.Client, *sftp.Client, error) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	if c.closed {
+		return nil, nil, ErrClientClosed
+	}
+	return c.ssh, c.sftp, nil
+}
+
+// withSFTP runs fn with the current sftp client, fn is retried on a new connection
+// if the connection is broken, so it must be safe to be called again
+func (c *Client) withSFTP(fn func(*sftp.Client) error) error {
+	var err error
+	for i := 0; i <= maxReconnect; i++ {
+		sshClient, sftpClient, cerr := c.clients()
+		if cerr != nil {
+			return cerr
+		}
+		if sftpClient == nil {
+			err = fmt.Errorf("sftp client not init")
+		} else {
+			err = fn(sftpClient)
+			if !isConnectionError(err) {
+				return err
+			}
+		}
+		if i == maxReconnect {
+			break
+		}
+		time.Sleep(time.Duration(i) * 2 * time.Second)
+		if rerr := c.reconnect(sshClient); rerr != nil {
+			c.log.Errorf("reconnect fail, error: %v", rerr)
+		}
+	}
+	return err
+}
+
+// newSession opens a session, it reconnects if the connection is broken. The command
+// itself is never retried since it may not be idempotent
+func (c *Client) newSession() (*ssh.Session, error) {
+	var err error
+	for i := 0; i <= maxReconnect; i++ {
+		sshClient, _, cerr := c.clients()
+		if cerr != nil {
+			return nil, cerr
+		}
+		if sshClient == nil {
+			err = fmt.Errorf("ssh client not init")
+		} else {
+			var sess *ssh.Session
+			sess, err = sshClient.NewSession()
+			if err == nil {
+				return sess, nil
+			}
+			if !isConnectionError(err) {
+				return nil, err
+			}
+		}
+		if i == maxReconnect {
+			break
+		}
+		time.Sleep(time.Duration(i) * 2 * time.Second)
+		if rerr := c.reconnect(sshClient); rerr != nil {
+			c.log.Errorf("reconnect fail, error: %v", rerr)
+		}
+	}
+	return nil, err
+}
+
+func (c *Client) stat(path string) (os.FileInfo, error) {
+	var fi os.FileInfo
+	err := c.withSFTP(func(cli *sftp.Client) error {
+		var err error
+		fi, err = cli.Stat(path)
+		return err
+	})
+	return fi, err
+}
+
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, sftp.ErrSSHFxConnectionLost) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "connection lost") || strings.Contains(msg, "broken pipe") ||
+		strings.Contains(msg, "use of closed network connection")
+}
+
+// Close closes the connection to the node, the client cannot be used after it
+func (c *Client) Close() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.disconnect()
+	if c.agentConn != nil {
+		c.agentConn.Close()
+		c.agentConn = nil
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+type debianClient struct {
+	*Client
+}
+
+func (d *debianClient) Install(pkgDir string) error {
+	var entries []os.FileInfo
+	err := d.withSFTP(func(cli *sftp.Client) error {
+		var err error
+		entries, err = cli.ReadDir(pkgDir)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var debs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(entry.Name(), ".deb") {
+			debs = append(debs, filepath.Join(pkgDir, entry.Name()))
+		}
+	}
+
+	if len(debs) == 0 {
+		d.log.Warningf("no deb files to be installed")
+		return nil
+	}
+
+	return d.install(debs)
+}
+
+func (d *debianClient) Uninstall(pkgs []string) error {
+	installed, err := d.listInstalled()
+	if err != nil {
+		return err
+	}
+	var removing []string
+	for _, pkg := range pkgs {
+		if _, ok := installed[pkg]; ok {
+			removing = append(removing, pkg)
+		}
+	}
+	if len(removing) == 0 {
+		return nil
+	}
+
+	cmd := fmt.Sprintf("apt-get remove -y %s", strings.Join(removing, " "))
+	_, err = d.Exec(context.Background(), cmd, WithEnv("DEBIAN_FRONTEND", "noninteractive"), WithTimeout(installTimeout))
+	return err
+}
+
+func (d *debianClient) install(debs []string) error {
+	installed, err := d.listInstalled()
+	if err != nil {
+		return err
+	}
+
+	var installing []string
+	for _, deb := range debs {
+		output, err := d.execCommand("dpkg-deb -f " + shellQuote(deb) + " Package Version")
+		if err != nil {
+			return fmt.Errorf("read deb %s fail: %v, message: %s", deb, err, output)
+		}
+		var name, version string
+		for _, line := range strings.Split(string(output), "\n") {
+			if v, ok := strings.CutPrefix(line, "Package: "); ok {
+				name = v
+			}
+			if v, ok := strings.CutPrefix(line, "Version: "); ok {
+				version = v
+			}
+		}
+		if installed[name] != version {
+			installing = append(installing, deb)
+		}
+	}
+	if len(installing) == 0 {
+		d.log.Printf("all deb packages have been installed")
+		return nil
+	}
+
+	// apt resolves the dependencies between the given debs, dpkg is the fallback when apt is broken
+	var args []string
+	for _, deb := range installing {
+		args = append(args, shellQuote(deb))
+	}
+	options := []CommandOption{WithEnv("DEBIAN_FRONTEND", "noninteractive"), WithTimeout(installTimeout)}
+	cmd := fmt.Sprintf("apt-get install -y --no-install-recommends %s", strings.Join(args, " "))
+	_, err = d.Exec(context.Background(), cmd, options...)
+	if err == nil {
+		return nil
+	}
+	d.log.Warnf("apt-get install fail, fallback to dpkg, error: %v", err)
+	cmd = fmt.Sprintf("dpkg -i %s", strings.Join(args, " "))
+	_, err = d.Exec(context.Background(), cmd, options...)
+	return err
+}
+
+// listInstalled returns the installed packages and their versions
+func (d *debianClient) listInstalled() (map[string]string, error) {
+	output, err := d.execCommand(`dpkg-query -W -f='${db:Status-Abbrev} ${Package} ${Version}\n'`)
+	if err != nil {
+		return nil, err
+	}
+	installed := make(map[string]string)
+	for _, line := range bytes.Split(bytes.TrimRight(output, "\n"), []byte("\n")) {
+		fields := strings.Fields(string(line))
+		if len(fields) != 3 || fields[0] != "ii" {
+			continue
+		}
+		installed[fields[1]] = fields[2]
+	}
+	return installed, nil
+}
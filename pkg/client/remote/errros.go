@@ -5,4 +5,5 @@ import "errors"
 var (
 	ErrK3SNotRunning = errors.New("k3s is not running")
 	ErrFileExist     = errors.New("file has been exist")
+	ErrClientClosed  = errors.New("remote client has been closed")
 )
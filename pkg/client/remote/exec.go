@@ -0,0 +1,290 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// pidMarker prefixes the first line of output which carries the pid of remote shell
+const pidMarker = "__K3S_INSTALLER_PID__"
+
+type commandOptions struct {
+	env     map[string]string
+	timeout time.Duration
+	stdin   io.Reader
+	stream  bool
+}
+
+type CommandOption func(*commandOptions)
+
+// WithEnv sets an environment variable of the command
+func WithEnv(key, value string) CommandOption {
+	return func(o *commandOptions) {
+		if o.env == nil {
+			o.env = make(map[string]string)
+		}
+		o.env[key] = value
+	}
+}
+
+// WithTimeout kills the command if it does not finish in time
+func WithTimeout(timeout time.Duration) CommandOption {
+	return func(o *commandOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithStdin feeds r to the stdin of command
+func WithStdin(r io.Reader) CommandOption {
+	return func(o *commandOptions) {
+		o.stdin = r
+	}
+}
+
+// WithQuiet stops streaming output into log, it is used for commands whose output is parsed
+func WithQuiet() CommandOption {
+	return func(o *commandOptions) {
+		o.stream = false
+	}
+}
+
+// ExitError is returned when the remote command exits with non-zero status
+type ExitError struct {
+	Command string
+	Code    int
+	Signal  string
+	// Stderr is the tail of the stderr of command
+	Stderr string
+}
+
+func (e *ExitError) Error() string {
+	var msg string
+	if e.Signal != "" {
+		msg = fmt.Sprintf("command '%s' killed by signal %s", e.Command, e.Signal)
+	} else {
+		msg = fmt.Sprintf("command '%s' exit with code %d", e.Command, e.Code)
+	}
+	if e.Stderr != "" {
+		msg += ", stderr: " + e.Stderr
+	}
+	return msg
+}
+
+// Exec runs cmd on the node, the stdout and stderr are streamed into log line by line
+// and the stdout is returned, the stderr is carried by ExitError only so the output can be
+// parsed. The remote process is killed when ctx is done.
+func (c *Client) Exec(ctx context.Context, cmd string, options ...CommandOption) ([]byte, error) {
+	opts := &commandOptions{stream: true}
+	for _, opt := range options {
+		opt(opts)
+	}
+	return c.exec(ctx, cmd, opts)
+}
+
+func (c *Client) execCommand(cmd string, options ...CommandOption) ([]byte, error) {
+	opts := &commandOptions{}
+	for _, opt := range options {
+		opt(opts)
+	}
+	return c.exec(context.Background(), cmd, opts)
+}
+
+func (c *Client) exec(ctx context.Context, cmd string, opts *commandOptions) ([]byte, error) {
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+
+	sess, err := c.newSession()
+	if err != nil {
+		return nil, err
+	}
+	defer sess.Close()
+
+	script := cmd
+	if len(opts.env) > 0 {
+		keys := make([]string, 0, len(opts.env))
+		for k := range opts.env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var exports []string
+		for _, k := range keys {
+			exports = append(exports, fmt.Sprintf("export %s=%s;", k, shellQuote(opts.env[k])))
+		}
+		script = strings.Join(exports, " ") + " " + cmd
+	}
+	// run the script as the leader of a new process group, so it is killed with all its
+	// descendants. setsid forks when called by a group leader, it is started in background to
+	// avoid that, the stdin is passed explicitly since background commands read /dev/null.
+	script = fmt.Sprintf("echo %s$$; %s", pidMarker, script)
+	script = fmt.Sprintf("exec 3<&0; setsid sh -c %s 0<&3 3<&- & wait $!", shellQuote(script))
+	remoteCmd, password := c.becomeCommand(script)
+
+	var stdin []io.Reader
+	if password != "" {
+		stdin = append(stdin, strings.NewReader(password))
+	}
+	if opts.stdin != nil {
+		stdin = append(stdin, opts.stdin)
+	}
+	if len(stdin) > 0 {
+		sess.Stdin = io.MultiReader(stdin...)
+	}
+
+	stdout, err := sess.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := sess.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	out := &commandOutput{}
+	if err = sess.Start(remoteCmd); err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		out.scan(stdout, &out.stdout, func(line string) {
+			if opts.stream {
+				c.log.Infoln(line)
+			}
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		out.scan(stderr, &out.stderr, func(line string) {
+			if opts.stream {
+				c.log.Warnln(line)
+			}
+		})
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		wg.Wait()
+		done <- sess.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		c.kill(sess, out.pid())
+		return out.bytes(), fmt.Errorf("command '%s' canceled: %w", cmd, ctx.Err())
+	}
+
+	if err != nil {
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			return out.bytes(), &ExitError{Command: cmd, Code: exitErr.ExitStatus(), Signal: exitErr.Signal(), Stderr: out.stderrTail()}
+		}
+		return out.bytes(), err
+	}
+	return out.bytes(), nil
+}
+
+// kill stops the remote process, signals are not supported by old sshd so the process
+// group of the command is killed in another session as well
+func (c *Client) kill(sess *ssh.Session, pid int) {
+	_ = sess.Signal(ssh.SIGKILL)
+	if pid > 0 {
+		sh := fmt.Sprintf("kill -KILL -- -%d", pid)
+		if _, err := c.execCommand(sh, WithTimeout(15*time.Second)); err != nil {
+			c.log.Warnf("fail to kill remote process %d, error: %v", pid, err)
+		}
+	}
+	_ = sess.Close()
+}
+
+type commandOutput struct {
+	mux       sync.Mutex
+	stdout    bytes.Buffer
+	stderr    bytes.Buffer
+	remotePID int
+}
+
+// maxStderrSize is the size of the stderr tail kept in ExitError
+const maxStderrSize = 4096
+
+// maxLineSize is the size of a line kept in output, the rest of a longer line is dropped
+const maxLineSize = 1024 * 1024
+
+// scan reads r to the end into buf, the remote command blocks if its output is not drained
+func (o *commandOutput) scan(r io.Reader, buf *bytes.Buffer, fn func(line string)) {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, err := readLine(reader)
+		if err != nil {
+			return
+		}
+		o.mux.Lock()
+		if o.remotePID == 0 && strings.HasPrefix(line, pidMarker) {
+			o.remotePID, _ = strconv.Atoi(strings.TrimPrefix(line, pidMarker))
+			o.mux.Unlock()
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+		o.mux.Unlock()
+		fn(line)
+	}
+}
+
+// readLine reads a line without line break, a line longer than maxLineSize is truncated
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		if len(line) < maxLineSize {
+			line = append(line, chunk...)
+		}
+		if !isPrefix {
+			if len(line) > maxLineSize {
+				line = line[:maxLineSize]
+			}
+			return string(line), nil
+		}
+	}
+}
+
+func (o *commandOutput) bytes() []byte {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	return append([]byte(nil), o.stdout.Bytes()...)
+}
+
+func (o *commandOutput) stderrTail() string {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	data := bytes.TrimSpace(o.stderr.Bytes())
+	if len(data) > maxStderrSize {
+		data = append([]byte("..."), data[len(data)-maxStderrSize:]...)
+	}
+	return string(data)
+}
+
+func (o *commandOutput) pid() int {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	return o.remotePID
+}
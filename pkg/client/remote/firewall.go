@@ -0,0 +1,359 @@
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/godzilla-s/k3s-installer/pkg/utils"
+)
+
+// Port is a port or port range like 2379-2380 to be opened in firewall
+type Port struct {
+	Port     string
+	Protocol string
+}
+
+func (p Port) String() string {
+	return fmt.Sprintf("%s/%s", p.Port, p.Protocol)
+}
+
+type firewall interface {
+	name() string
+	// open allows the ports and all the traffic from sources
+	open(ports []Port, sources []string) error
+	close(ports []Port, sources []string) error
+	stop() error
+}
+
+// detectFirewall returns the active firewall of node, it returns nil if there is no firewall running
+func (c *Client) detectFirewall() (firewall, error) {
+	if output, _ := c.execCommand("systemctl is-active firewalld"); string(bytes.TrimSpace(output)) == "active" {
+		return &firewalld{c}, nil
+	}
+	if output, err := c.execCommand("ufw status"); err == nil && bytes.Contains(output, []byte("Status: active")) {
+		return &ufw{c}, nil
+	}
+	if _, err := c.execCommand("nft list chain inet filter input"); err == nil {
+		return &nftables{c}, nil
+	}
+	return nil, nil
+}
+
+// OpenPorts allows the given ports and the traffic from the given CIDRs in the active firewall
+func (c *Client) OpenPorts(ports []Port, sources []string) error {
+	fw, err := c.detectFirewall()
+	if err != nil {
+		return err
+	}
+	if fw == nil {
+		c.log.Printf("no active firewall, skip opening ports")
+		return nil
+	}
+	c.log.Printf("open ports in %s: %v, trust sources: %v", fw.name(), ports, sources)
+	return fw.open(ports, sources)
+}
+
+// ClosePorts removes the rules added by OpenPorts
+func (c *Client) ClosePorts(ports []Port, sources []string) error {
+	fw, err := c.detectFirewall()
+	if err != nil {
+		return err
+	}
+	if fw == nil {
+		return nil
+	}
+	c.log.Printf("close ports in %s: %v, untrust sources: %v", fw.name(), ports, sources)
+	return fw.close(ports, sources)
+}
+
+// StopFirewall disables the active firewall
+func (c *Client) StopFirewall() error {
+	fw, err := c.detectFirewall()
+	if err != nil {
+		return err
+	}
+	if fw == nil {
+		return nil
+	}
+	c.log.Printf("disable firewall %s", fw.name())
+	return fw.stop()
+}
+
+func (c *Client) runAll(cmds []string) error {
+	for _, cmd := range cmds {
+		output, err := c.execCommand(cmd)
+		if err != nil {
+			return fmt.Errorf("%v, message: %s", err, bytes.TrimSpace(output))
+		}
+	}
+	return nil
+}
+
+// firewalld opens the ports by the service and trusts the sources by the zone both named
+// firewalldName, so closing them never touches the rules the operator had before
+type firewalld struct {
+	*Client
+}
+
+const firewalldName = "k3s-installer"
+
+func (f *firewalld) name() string {
+	return "firewalld"
+}
+
+func (f *firewalld) open(ports []Port, sources []string) error {
+	cmds := []string{
+		fmt.Sprintf("firewall-cmd --permanent --info-service=%s >/dev/null 2>&1 || firewall-cmd --permanent --new-service=%s", firewalldName, firewalldName),
+	}
+	for _, p := range ports {
+		cmds = append(cmds, fmt.Sprintf("firewall-cmd --permanent --service=%s --add-port=%s", firewalldName, p))
+	}
+	cmds = append(cmds, fmt.Sprintf("firewall-cmd --permanent --add-service=%s", firewalldName))
+
+	if len(sources) > 0 {
+		cmds = append(cmds,
+			fmt.Sprintf("firewall-cmd --permanent --info-zone=%s >/dev/null 2>&1 || firewall-cmd --permanent --new-zone=%s", firewalldName, firewalldName),
+			fmt.Sprintf("firewall-cmd --permanent --zone=%s --set-target=ACCEPT", firewalldName))
+	}
+	for _, source := range sources {
+		// a source belongs to one zone only, the zone the operator has chosen is kept
+		output, err := f.execCommand("firewall-cmd --permanent --get-zone-of-source=" + source)
+		if zone := string(bytes.TrimSpace(output)); err == nil && zone != "" && zone != firewalldName {
+			f.log.Warnf("source %s is already in zone %s, skip trusting it", source, zone)
+			continue
+		}
+		cmds = append(cmds, fmt.Sprintf("firewall-cmd --permanent --zone=%s --add-source=%s", firewalldName, source))
+	}
+	return f.runAll(append(cmds, "firewall-cmd --reload"))
+}
+
+func (f *firewalld) close(ports []Port, sources []string) error {
+	return f.runAll([]string{
+		fmt.Sprintf("if firewall-cmd --permanent --info-service=%s >/dev/null 2>&1; then firewall-cmd --permanent --remove-service=%s && firewall-cmd --permanent --delete-service=%s; fi",
+			firewalldName, firewalldName, firewalldName),
+		fmt.Sprintf("if firewall-cmd --permanent --info-zone=%s >/dev/null 2>&1; then firewall-cmd --permanent --delete-zone=%s; fi",
+			firewalldName, firewalldName),
+		"firewall-cmd --reload",
+	})
+}
+
+func (f *firewalld) stop() error {
+	return f.runAll([]string{"systemctl disable --now firewalld"})
+}
+
+// ufw marks the rules it adds by ufwComment, the rules existing before are neither added
+// again nor deleted
+type ufw struct {
+	*Client
+}
+
+const ufwComment = "k3s-installer"
+
+func (u *ufw) name() string {
+	return "ufw"
+}
+
+func (u *ufw) rule(p Port) string {
+	return fmt.Sprintf("allow %s/%s", strings.ReplaceAll(p.Port, "-", ":"), p.Protocol)
+}
+
+// addedRules returns the rules listed by ufw show added, like allow 6443/tcp, and whether
+// they are added by installer
+func (u *ufw) addedRules() (map[string]bool, error) {
+	output, err := u.execCommand("ufw show added")
+	if err != nil {
+		return nil, fmt.Errorf("%v, message: %s", err, output)
+	}
+	rules := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(line), "ufw ")
+		if !ok {
+			continue
+		}
+		rule, comment, _ := strings.Cut(rest, " comment ")
+		rules[rule] = comment == "'"+ufwComment+"'"
+	}
+	return rules, nil
+}
+
+func (u *ufw) open(ports []Port, sources []string) error {
+	existing, err := u.addedRules()
+	if err != nil {
+		return err
+	}
+	var rules []string
+	for _, p := range ports {
+		rules = append(rules, u.rule(p))
+	}
+	for _, source := range sources {
+		rules = append(rules, "allow from "+source)
+	}
+	var cmds []string
+	for _, rule := range rules {
+		if _, ok := existing[rule]; ok {
+			continue
+		}
+		cmds = append(cmds, fmt.Sprintf("ufw %s comment %s", rule, ufwComment))
+	}
+	return u.runAll(cmds)
+}
+
+func (u *ufw) close(ports []Port, sources []string) error {
+	existing, err := u.addedRules()
+	if err != nil {
+		return err
+	}
+	var cmds []string
+	for _, rule := range utils.SortedKeys(existing) {
+		if existing[rule] {
+			cmds = append(cmds, "ufw delete "+rule)
+		}
+	}
+	return u.runAll(cmds)
+}
+
+func (u *ufw) stop() error {
+	return u.runAll([]string{"ufw disable"})
+}
+
+// nftables adds rules into the input chain of inet filter table, they are marked by
+// comment so that they can be found and deleted. The rules are persisted in nftRulesFile
+// which is included by the nftables.conf loaded at boot.
+type nftables struct {
+	*Client
+}
+
+const (
+	nftComment   = "k3s-installer"
+	nftRulesFile = "/etc/nftables.d/k3s-installer.nft"
+)
+
+// nftConfFiles are the files loaded by nftables service on debian and rhel families
+var nftConfFiles = []string{"/etc/nftables.conf", "/etc/sysconfig/nftables.conf"}
+
+func nftPortRule(p Port) string {
+	return fmt.Sprintf(`%s dport %s accept comment "%s %s"`, p.Protocol, p.Port, nftComment, p)
+}
+
+func nftSourceRule(source string) string {
+	family := "ip"
+	if strings.Contains(source, ":") {
+		family = "ip6"
+	}
+	return fmt.Sprintf(`%s saddr %s accept comment "%s %s"`, family, source, nftComment, source)
+}
+
+func (n *nftables) name() string {
+	return "nftables"
+}
+
+func (n *nftables) open(ports []Port, sources []string) error {
+	existing, err := n.ruleHandles()
+	if err != nil {
+		return err
+	}
+	var cmds, rules []string
+	for _, p := range ports {
+		rules = append(rules, nftPortRule(p))
+		if _, ok := existing[p.String()]; !ok {
+			cmds = append(cmds, "nft insert rule inet filter input "+shellQuote(nftPortRule(p)))
+		}
+	}
+	for _, source := range sources {
+		rules = append(rules, nftSourceRule(source))
+		if _, ok := existing[source]; !ok {
+			cmds = append(cmds, "nft insert rule inet filter input "+shellQuote(nftSourceRule(source)))
+		}
+	}
+	if err = n.persist(rules); err != nil {
+		return err
+	}
+	return n.runAll(cmds)
+}
+
+// persist writes the rules into nftRulesFile and includes it by nftables.conf, so the ports are
+// still open after reboot. The table and chain are added in case nftables.conf does not define
+// them, otherwise the whole file fails to load.
+func (n *nftables) persist(rules []string) error {
+	var conf string
+	for _, f := range nftConfFiles {
+		if _, err := n.stat(f); err == nil {
+			conf = f
+			break
+		}
+	}
+	if conf == "" {
+		return fmt.Errorf("none of %s found, the nftables rules cannot be persisted, open the ports manually and set firewall mode skip",
+			strings.Join(nftConfFiles, ", "))
+	}
+
+	lines := []string{
+		"# managed by k3s-installer, it is removed on uninstall",
+		"add table inet filter",
+		"add chain inet filter input",
+	}
+	for _, rule := range rules {
+		lines = append(lines, "insert rule inet filter input "+rule)
+	}
+	if err := n.WriteFile(nftRulesFile, []byte(strings.Join(lines, "\n")+"\n"), 0644, true); err != nil {
+		return fmt.Errorf("write %s fail: %v", nftRulesFile, err)
+	}
+	include := fmt.Sprintf(`include "%s"`, nftRulesFile)
+	return n.runAll([]string{fmt.Sprintf("grep -qxF %s %s || echo %s >> %s",
+		shellQuote(include), conf, shellQuote(include), conf)})
+}
+
+func (n *nftables) close(ports []Port, sources []string) error {
+	existing, err := n.ruleHandles()
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for _, p := range ports {
+		keys = append(keys, p.String())
+	}
+	var cmds []string
+	for _, key := range append(keys, sources...) {
+		if handle, ok := existing[key]; ok {
+			cmds = append(cmds, fmt.Sprintf("nft delete rule inet filter input handle %s", handle))
+		}
+	}
+	// the dots are the only special characters of sed in the include line
+	include := strings.ReplaceAll(fmt.Sprintf(`include "%s"`, nftRulesFile), ".", `\.`)
+	for _, conf := range nftConfFiles {
+		cmds = append(cmds, fmt.Sprintf("if [ -f %s ]; then sed -i %s %s; fi", conf, shellQuote(`\|^`+include+`$|d`), conf))
+	}
+	return n.runAll(append(cmds, "rm -f "+nftRulesFile))
+}
+
+// ruleHandles returns the handles of rules added by installer, keyed by port or source
+func (n *nftables) ruleHandles() (map[string]string, error) {
+	output, err := n.execCommand("nft -a list chain inet filter input")
+	if err != nil {
+		return nil, fmt.Errorf("%v, message: %s", err, output)
+	}
+	handles := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		_, rest, ok := strings.Cut(line, `comment "`+nftComment+" ")
+		if !ok {
+			continue
+		}
+		port, rest, ok := strings.Cut(rest, `"`)
+		if !ok {
+			continue
+		}
+		_, handle, ok := strings.Cut(rest, "# handle ")
+		if !ok {
+			continue
+		}
+		handles[port] = strings.TrimSpace(handle)
+	}
+	return handles, nil
+}
+
+// stop deletes the inet filter table detected as the firewall only, the tables of other software
+// like docker and libvirt are kept. The service is not stopped since it flushes the whole ruleset.
+func (n *nftables) stop() error {
+	return n.runAll([]string{"systemctl disable nftables", "nft delete table inet filter"})
+}
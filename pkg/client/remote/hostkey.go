@@ -0,0 +1,170 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyConfig defines how the host key of remote node is verified
+type HostKeyConfig struct {
+	// KnownHosts are the known_hosts files to check host key against
+	KnownHosts []string
+	// WorkspaceKnownHosts records the new host keys in tofu policy
+	WorkspaceKnownHosts string
+	// Fingerprint is the pinned host key fingerprint, eg. SHA256:xxxx
+	Fingerprint string
+	// TOFU trusts and records the host key of unknown host on first use
+	TOFU     bool
+	Insecure bool
+}
+
+// serialize writing of workspace known_hosts between nodes
+var knownHostsLock sync.Mutex
+
+func expandHome(path string) (string, error) {
+	if !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[2:]), nil
+}
+
+func hostKeyCallback(conf *HostKeyConfig) ssh.HostKeyCallback {
+	if conf == nil || conf.Insecure {
+		return ssh.InsecureIgnoreHostKey()
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if conf.Fingerprint != "" {
+			if conf.Fingerprint == ssh.FingerprintSHA256(key) || conf.Fingerprint == ssh.FingerprintLegacyMD5(key) {
+				return nil
+			}
+			return fmt.Errorf("host key mismatch for %s: expect fingerprint %s, got %s", hostname, conf.Fingerprint, ssh.FingerprintSHA256(key))
+		}
+
+		knownHostsLock.Lock()
+		defer knownHostsLock.Unlock()
+
+		err := checkKnownHosts(conf, hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+			// changed host key, someone may be doing something nasty
+			return fmt.Errorf("host key verification failed for %s: %v", hostname, err)
+		}
+
+		if !conf.TOFU || conf.WorkspaceKnownHosts == "" {
+			return fmt.Errorf("unknown host key for %s, fingerprint: %s", hostname, ssh.FingerprintSHA256(key))
+		}
+		return addKnownHost(conf.WorkspaceKnownHosts, hostname, remote, key)
+	}
+}
+
+func checkKnownHosts(conf *HostKeyConfig, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	files, err := knownHostsFiles(conf)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return &knownhosts.KeyError{}
+	}
+	callback, err := knownhosts.New(files...)
+	if err != nil {
+		return err
+	}
+	return callback(hostname, remote, key)
+}
+
+// knownHostsFiles returns the existing known_hosts files of conf
+func knownHostsFiles(conf *HostKeyConfig) ([]string, error) {
+	var files []string
+	for _, file := range append(conf.KnownHosts, conf.WorkspaceKnownHosts) {
+		if file == "" {
+			continue
+		}
+		file, err := expandHome(file)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// probeKey is never known, checking it returns the known keys of host
+type probeKey struct{}
+
+func (probeKey) Type() string                                 { return "probe" }
+func (probeKey) Marshal() []byte                              { return []byte("probe") }
+func (probeKey) Verify(data []byte, sig *ssh.Signature) error { return errors.New("probe key") }
+
+// hostKeyAlgorithms returns the algorithms of the keys known for address, so the server does not
+// offer a key of another type which is taken as a changed key. Like openssh, nil is returned for
+// unknown host to accept any key.
+func hostKeyAlgorithms(conf *HostKeyConfig, address string) []string {
+	if conf == nil || conf.Insecure || conf.Fingerprint != "" {
+		return nil
+	}
+	files, err := knownHostsFiles(conf)
+	if err != nil || len(files) == 0 {
+		return nil
+	}
+	callback, err := knownhosts.New(files...)
+	if err != nil {
+		return nil
+	}
+	var keyErr *knownhosts.KeyError
+	if err = callback(address, &net.TCPAddr{}, probeKey{}); !errors.As(err, &keyErr) {
+		return nil
+	}
+	var algorithms []string
+	for _, known := range keyErr.Want {
+		switch typ := known.Key.Type(); typ {
+		case ssh.KeyAlgoRSA:
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		default:
+			algorithms = append(algorithms, typ)
+		}
+	}
+	sort.Strings(algorithms)
+	return algorithms
+}
+
+func addKnownHost(file, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	file, err := expandHome(file)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	addresses := []string{knownhosts.Normalize(hostname)}
+	if remote != nil && remote.String() != hostname {
+		addresses = append(addresses, knownhosts.Normalize(remote.String()))
+	}
+	_, err = fmt.Fprintln(f, knownhosts.Line(addresses, key))
+	return err
+}
@@ -0,0 +1,118 @@
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	FamilyRHEL   = "rhel"
+	FamilyDebian = "debian"
+	FamilySUSE   = "suse"
+)
+
+// OSRelease is parsed from /etc/os-release
+type OSRelease struct {
+	ID        string
+	IDLike    []string
+	VersionID string
+	Family    string
+}
+
+func (r *OSRelease) String() string {
+	return fmt.Sprintf("%s %s", r.ID, r.VersionID)
+}
+
+// Is tells whether the os is name or derived from it
+func (r *OSRelease) Is(name string) bool {
+	if name == r.ID || name == r.Family {
+		return true
+	}
+	for _, like := range r.IDLike {
+		if name == like {
+			return true
+		}
+	}
+	return false
+}
+
+func parseOSRelease(data []byte) *OSRelease {
+	values := make(map[string]string)
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		key, value, ok := strings.Cut(strings.TrimSpace(string(line)), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, "'")
+		}
+		values[key] = value
+	}
+	release := &OSRelease{
+		ID:        strings.ToLower(values["ID"]),
+		IDLike:    strings.Fields(strings.ToLower(values["ID_LIKE"])),
+		VersionID: values["VERSION_ID"],
+	}
+	release.Family = osFamily(release.ID, release.IDLike)
+	return release
+}
+
+func osFamily(id string, idLike []string) string {
+	for _, name := range append([]string{id}, idLike...) {
+		switch name {
+		case "rhel", "centos", "fedora", "rocky", "almalinux", "ol", "amzn", "kylin", "openeuler", "anolis":
+			return FamilyRHEL
+		case "debian", "ubuntu":
+			return FamilyDebian
+		case "suse", "sles", "opensuse", "opensuse-leap", "opensuse-tumbleweed":
+			return FamilySUSE
+		}
+	}
+	return ""
+}
+
+// detectOS reads /etc/os-release and selects the system action of node, expected is
+// the os given by config, it is checked against the detected one if it is not empty
+func (c *Client) detectOS(expected string) error {
+	data, err := c.ReadFile("/etc/os-release")
+	if err != nil {
+		return fmt.Errorf("fail to read /etc/os-release: %v", err)
+	}
+	release := parseOSRelease(data)
+	if expected != "" && !release.Is(strings.ToLower(expected)) {
+		return fmt.Errorf("os mismatch: %s is configured but %s is detected", expected, release)
+	}
+	switch release.Family {
+	case FamilyRHEL:
+		c.SystemAction = &centosClient{Client: c}
+	case FamilyDebian:
+		c.SystemAction = &debianClient{Client: c}
+	case FamilySUSE:
+		c.SystemAction = &suseClient{Client: c}
+	default:
+		return fmt.Errorf("unsupported os %s", release)
+	}
+	c.release = release
+	c.log.Printf("detected os: %s, family: %s", release, release.Family)
+	return nil
+}
+
+// normalizeArch converts the output of uname -m to the arch name used by k3s artifacts
+func normalizeArch(machine string) string {
+	switch machine {
+	case "x86_64", "amd64":
+		return "amd64"
+	case "aarch64", "arm64":
+		return "arm64"
+	case "armv7l", "armv7", "armhf":
+		return "arm"
+	case "s390x":
+		return "s390x"
+	default:
+		return machine
+	}
+}
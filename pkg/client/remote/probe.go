@@ -0,0 +1,190 @@
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/godzilla-s/k3s-installer/pkg/utils"
+)
+
+// ErrNoPython is returned when there is no python on node to run the listeners or probes
+var ErrNoPython = errors.New("python not found")
+
+const findPython = `PY=$(command -v python3 || command -v python || command -v /usr/libexec/platform-python) || exit 127`
+
+// listenerScript listens on the given ports, and records the received probes into a file.
+// It works with both python2 and python3.
+const listenerScript = `import socket,select,sys,time
+out=open(sys.argv[1],"a")
+end=time.time()+float(sys.argv[2])
+socks={}
+for spec in sys.argv[3:]:
+    port,proto=spec.split("/")
+    s=socket.socket(socket.AF_INET,socket.SOCK_STREAM if proto=="tcp" else socket.SOCK_DGRAM)
+    s.setsockopt(socket.SOL_SOCKET,socket.SO_REUSEADDR,1)
+    try:
+        s.bind(("0.0.0.0",int(port)))
+        if proto=="tcp":
+            s.listen(16)
+        socks[s]=spec
+    except Exception:
+        out.write("busy %s\n"%spec)
+out.write("ready\n")
+out.flush()
+while socks and time.time()<end:
+    r,_,_=select.select(list(socks),[],[],0.5)
+    for s in r:
+        spec=socks[s]
+        try:
+            if spec.endswith("tcp"):
+                c,_=s.accept()
+                c.settimeout(2)
+                d=c.recv(128)
+                c.close()
+            else:
+                d,_=s.recvfrom(128)
+        except Exception:
+            continue
+        out.write("recv %s %s\n"%(spec,d.decode("ascii","ignore").strip()))
+        out.flush()
+`
+
+// probeScript connects the targets, udp probes are only sent and checked by the listener
+const probeScript = `import socket,sys
+token=sys.argv[1].encode()
+for spec in sys.argv[2:]:
+    host,port,proto=spec.rsplit("/",2)
+    try:
+        if proto=="tcp":
+            s=socket.create_connection((host,int(port)),3)
+            s.sendall(token)
+        else:
+            s=socket.socket(socket.AF_INET,socket.SOCK_DGRAM)
+            for i in range(3):
+                s.sendto(token,(host,int(port)))
+        s.close()
+        print("ok %s"%spec)
+    except Exception as e:
+        print("fail %s %s"%(spec,e))
+`
+
+// ProbeTarget is a port of node to be probed
+type ProbeTarget struct {
+	Host string
+	Port Port
+}
+
+func (t ProbeTarget) String() string {
+	return fmt.Sprintf("%s/%s/%s", t.Host, t.Port.Port, t.Port.Protocol)
+}
+
+// ListenerRecord is what the probe listener has seen
+type ListenerRecord struct {
+	// Busy are the ports which could not be listened since they are used
+	Busy map[string]bool
+	// Received are the tokens of probes received on the ports
+	Received map[string][]string
+}
+
+// StartListeners listens on ports in background for duration, the probes received are recorded in
+// a new file created by mktemp, whose path is returned
+func (c *Client) StartListeners(ports []Port, duration time.Duration) (string, error) {
+	var specs []string
+	for _, p := range ports {
+		specs = append(specs, shellQuote(p.String()))
+	}
+	inner := fmt.Sprintf(`%s; exec "$PY" -c %s "$1" %d %s`, findPython, shellQuote(listenerScript),
+		int(duration.Seconds()), strings.Join(specs, " "))
+	cmd := fmt.Sprintf(`f=$(mktemp /tmp/k3s-installer-probe.XXXXXX) || exit 1; nohup sh -c %s sh "$f" >/dev/null 2>&1 & echo "$f"`,
+		shellQuote(inner))
+	output, err := c.execCommand(cmd)
+	if err != nil {
+		return "", fmt.Errorf("start listeners fail: %v, message: %s", err, output)
+	}
+	file := string(bytes.TrimSpace(output))
+
+	err = utils.Clock(5*time.Second, 200*time.Millisecond, func() error {
+		data, err := c.ReadFile(file)
+		if err != nil || !bytes.Contains(data, []byte("ready\n")) {
+			return fmt.Errorf("listeners not ready")
+		}
+		return nil
+	})
+	return file, err
+}
+
+// ReadListenerRecord reads the file written by listeners, and removes it
+func (c *Client) ReadListenerRecord(file string) (*ListenerRecord, error) {
+	data, err := c.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = c.execCommand("rm -f " + shellQuote(file))
+	record := &ListenerRecord{Busy: make(map[string]bool), Received: make(map[string][]string)}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 2 && fields[0] == "busy":
+			record.Busy[fields[1]] = true
+		case len(fields) == 3 && fields[0] == "recv":
+			record.Received[fields[1]] = append(record.Received[fields[1]], fields[2])
+		}
+	}
+	return record, nil
+}
+
+// Probe connects the targets from node, it returns whether the tcp targets are reachable.
+// The result of udp targets only means the probe has been sent.
+func (c *Client) Probe(token string, targets []ProbeTarget) (map[ProbeTarget]error, error) {
+	results := make(map[ProbeTarget]error)
+	if _, err := c.execCommand(findPython); err != nil {
+		// fallback to bash for tcp
+		for _, t := range targets {
+			if t.Port.Protocol != "tcp" {
+				results[t] = ErrNoPython
+				continue
+			}
+			cmd := fmt.Sprintf("timeout 3 bash -c %s", shellQuote(fmt.Sprintf("echo %s > /dev/tcp/%s/%s", token, t.Host, t.Port.Port)))
+			if output, err := c.execCommand(cmd); err != nil {
+				results[t] = fmt.Errorf("%v %s", err, bytes.TrimSpace(output))
+			} else {
+				results[t] = nil
+			}
+		}
+		return results, nil
+	}
+
+	var specs []string
+	for _, t := range targets {
+		specs = append(specs, shellQuote(t.String()))
+	}
+	cmd := fmt.Sprintf(`%s; exec "$PY" -c %s %s %s`, findPython, shellQuote(probeScript), shellQuote(token), strings.Join(specs, " "))
+	output, err := c.execCommand(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("probe fail: %v, message: %s", err, output)
+	}
+	lines := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) < 2 {
+			continue
+		}
+		lines[fields[1]] = line
+	}
+	for _, t := range targets {
+		line, ok := lines[t.String()]
+		switch {
+		case !ok:
+			results[t] = fmt.Errorf("no result")
+		case strings.HasPrefix(line, "ok "):
+			results[t] = nil
+		default:
+			_, reason, _ := strings.Cut(strings.TrimPrefix(line, "fail "), " ")
+			results[t] = errors.New(reason)
+		}
+	}
+	return results, nil
+}
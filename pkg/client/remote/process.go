@@ -0,0 +1,86 @@
+package remote
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Listener is a socket listening on node
+type Listener struct {
+	Protocol string
+	Port     int
+	Process  string
+	PID      int
+}
+
+// Process is a running process on node
+type Process struct {
+	Name string
+	PID  int
+}
+
+// Listeners returns the listening tcp and udp sockets of node
+func (c *Client) Listeners() ([]Listener, error) {
+	output, err := c.execCommand("ss -Htulnp")
+	if err != nil {
+		return nil, err
+	}
+	return parseListeners(string(output)), nil
+}
+
+// parseListeners parses the output of ss like
+// tcp LISTEN 0 4096 *:6443 *:* users:(("k3s-server",pid=1234,fd=15))
+func parseListeners(output string) []Listener {
+	var listeners []Listener
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		local := fields[4]
+		i := strings.LastIndex(local, ":")
+		if i < 0 {
+			continue
+		}
+		port, err := strconv.Atoi(local[i+1:])
+		if err != nil {
+			continue
+		}
+		l := Listener{Protocol: fields[0], Port: port}
+		if _, users, ok := strings.Cut(line, `users:(("`); ok {
+			name, rest, _ := strings.Cut(users, `"`)
+			l.Process = name
+			if _, pid, ok := strings.Cut(rest, "pid="); ok {
+				pid, _, _ = strings.Cut(pid, ",")
+				l.PID, _ = strconv.Atoi(pid)
+			}
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners
+}
+
+// FindProcesses returns the running processes whose name is one of names
+func (c *Client) FindProcesses(names []string) ([]Process, error) {
+	output, err := c.execCommand("ps -eo pid=,comm=")
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		wanted[name] = struct{}{}
+	}
+	var processes []Process
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if _, ok := wanted[fields[1]]; !ok {
+			continue
+		}
+		pid, _ := strconv.Atoi(fields[0])
+		processes = append(processes, Process{Name: fields[1], PID: pid})
+	}
+	return processes, nil
+}
@@ -0,0 +1,147 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// sudo does not keep /usr/local/bin in secure_path on rhel family, but install.sh and k3s live there
+const becomePath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// becomeCommand wraps cmd with sudo, the password is feed from stdin if it is given
+func (c *Client) becomeCommand(cmd string) (string, string) {
+	if !c.become {
+		return cmd, ""
+	}
+	wrapped := fmt.Sprintf("env PATH=%s sh -c %s", becomePath, shellQuote(cmd))
+	if c.becomePassword == "" || c.sudoNoPassword {
+		return "sudo -n " + wrapped, ""
+	}
+	// -k makes sudo always read the password, a cached credential would leave it in the stdin
+	// of the command
+	return "sudo -k -S -p '' " + wrapped, c.becomePassword + "\n"
+}
+
+// stagingDirName is the directory under the home of login user where files are uploaded before
+// they are installed with sudo
+const stagingDirName = ".k3s-installer"
+
+// prepareBecome checks whether sudo asks for password and prepares the staging directory, it runs
+// on the new connection directly since it is called when connecting
+func (c *Client) prepareBecome(sshClient *ssh.Client, sftpClient *sftp.Client) error {
+	if c.becomePassword != "" {
+		// NOPASSWD sudo never reads the password
+		_, err := runOutput(sshClient, "sudo -k -n true")
+		c.sudoNoPassword = err == nil
+	}
+
+	output, err := runOutput(sshClient, "id -u")
+	if err != nil {
+		return fmt.Errorf("fail to get uid of login user: %v", err)
+	}
+	uid, err := strconv.ParseUint(strings.TrimSpace(string(output)), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid uid '%s'", strings.TrimSpace(string(output)))
+	}
+	home, err := sftpClient.Getwd()
+	if err != nil {
+		return fmt.Errorf("fail to get home directory: %v", err)
+	}
+
+	dir := filepath.Join(home, stagingDirName)
+	fi, err := sftpClient.Lstat(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		if err = sftpClient.Mkdir(dir); err != nil {
+			return fmt.Errorf("create staging directory fail: %v", err)
+		}
+		if err = sftpClient.Chmod(dir, 0700); err != nil {
+			return fmt.Errorf("chmod staging directory fail: %v", err)
+		}
+		fi, err = sftpClient.Lstat(dir)
+	}
+	if err != nil {
+		return fmt.Errorf("stat staging directory fail: %v", err)
+	}
+	// the files in staging directory are installed as root, nobody else may touch them
+	if !fi.IsDir() {
+		return fmt.Errorf("staging directory %s is not a directory", dir)
+	}
+	if stat, ok := fi.Sys().(*sftp.FileStat); !ok || uint64(stat.UID) != uid {
+		return fmt.Errorf("staging directory %s is not owned by login user", dir)
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("staging directory %s has mode %o, expect 0700", dir, fi.Mode().Perm())
+	}
+	c.stagingDir = dir
+	c.loginUID = uid
+	return nil
+}
+
+// runOutput runs cmd in a new session of client without sudo
+func runOutput(client *ssh.Client, cmd string) ([]byte, error) {
+	sess, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer sess.Close()
+	return sess.Output(cmd)
+}
+
+// stagingPath returns the path sftp writes to, the file is moved to the target by installFile
+// since the login user cannot write to root-owned locations directly
+func (c *Client) stagingPath(target string) string {
+	if !c.become {
+		return target
+	}
+	name := strings.ReplaceAll(strings.TrimPrefix(target, "/"), "/", "_")
+	return filepath.Join(c.stagingDir, name)
+}
+
+func (c *Client) installFile(staging, target string, mode os.FileMode) error {
+	if !c.become {
+		return nil
+	}
+	// install to a temporary file next to target, so the rename is atomic
+	tmp := target + ".k3s-installer.tmp"
+	cmd := fmt.Sprintf("install -D -m %o %s %s && mv -f %s %s && rm -f %s", mode.Perm(),
+		shellQuote(staging), shellQuote(tmp), shellQuote(tmp), shellQuote(target), shellQuote(staging))
+	output, err := c.execCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("install %s fail: %v, message: %s", target, err, output)
+	}
+	return nil
+}
+
+// exportFile copies the root-owned file to staging owned by login user, so it can be read by sftp
+func (c *Client) exportFile(file, staging string) error {
+	cmd := fmt.Sprintf("install -m 600 -o %d %s %s", c.loginUID, shellQuote(file), shellQuote(staging))
+	output, err := c.execCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("read %s fail: %v, message: %s", file, err, output)
+	}
+	return nil
+}
+
+func (c *Client) mkdirAll(dir string) error {
+	if !c.become {
+		return c.withSFTP(func(cli *sftp.Client) error {
+			return cli.MkdirAll(dir)
+		})
+	}
+	output, err := c.execCommand("mkdir -p " + shellQuote(dir))
+	if err != nil {
+		return fmt.Errorf("mkdir %s fail: %v, message: %s", dir, err, output)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+type suseClient struct {
+	*Client
+}
+
+func (s *suseClient) Install(pkgDir string) error {
+	var entries []os.FileInfo
+	err := s.withSFTP(func(cli *sftp.Client) error {
+		var err error
+		entries, err = cli.ReadDir(pkgDir)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var rpms []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".rpm") {
+			rpms = append(rpms, shellQuote(filepath.Join(pkgDir, entry.Name())))
+		}
+	}
+	if len(rpms) == 0 {
+		s.log.Warningf("no rpm files to be installed")
+		return nil
+	}
+
+	cmd := fmt.Sprintf("zypper --non-interactive --no-gpg-checks install --allow-unsigned-rpm %s", strings.Join(rpms, " "))
+	_, err = s.Exec(context.Background(), cmd, WithTimeout(installTimeout))
+	return err
+}
+
+func (s *suseClient) Uninstall(pkgs []string) error {
+	var installed []string
+	for _, pkg := range pkgs {
+		if _, err := s.execCommand("rpm -q " + shellQuote(pkg)); err == nil {
+			installed = append(installed, pkg)
+		}
+	}
+	if len(installed) == 0 {
+		return nil
+	}
+	cmd := fmt.Sprintf("zypper --non-interactive remove %s", strings.Join(installed, " "))
+	_, err := s.Exec(context.Background(), cmd, WithTimeout(installTimeout))
+	return err
+}
@@ -0,0 +1,116 @@
+package remote
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// partSuffix is appended to the file being uploaded, it is renamed to the target when completed
+const partSuffix = ".k3s-installer.part"
+
+type localDigest struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// the same image tarballs are uploaded to every node, so the digest is computed only once
+var (
+	digestLock  sync.Mutex
+	digestCache = make(map[string]localDigest)
+)
+
+func fileSHA256(local string, fi os.FileInfo) (string, error) {
+	digestLock.Lock()
+	defer digestLock.Unlock()
+	if d, ok := digestCache[local]; ok && d.size == fi.Size() && d.modTime.Equal(fi.ModTime()) {
+		return d.sum, nil
+	}
+
+	f, err := os.Open(local)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	digestCache[local] = localDigest{size: fi.Size(), modTime: fi.ModTime(), sum: sum}
+	return sum, nil
+}
+
+func (c *Client) remoteSHA256(file string) (string, error) {
+	output, err := c.execCommand("sha256sum " + shellQuote(file))
+	if err != nil {
+		return "", fmt.Errorf("sha256sum %s fail: %v, message: %s", file, err, output)
+	}
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("sha256sum %s: empty output", file)
+	}
+	return fields[0], nil
+}
+
+// upload writes local into part, it resumes from the size of an existing part file
+func (c *Client) upload(cli *sftp.Client, local, part string, size int64) error {
+	var offset int64
+	if fi, err := cli.Stat(part); err == nil && fi.Size() <= size {
+		offset = fi.Size()
+	}
+
+	fr, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	fw, err := cli.OpenFile(part, os.O_CREATE|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	if offset == 0 {
+		err = fw.Truncate(0)
+	} else {
+		c.log.Printf("resume uploading %s from %d/%d bytes", local, offset, size)
+		_, err = fw.Seek(offset, io.SeekStart)
+		if err == nil {
+			_, err = fr.Seek(offset, io.SeekStart)
+		}
+	}
+	if err == nil && offset < size {
+		_, err = io.Copy(fw, fr)
+	}
+	if cerr := fw.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// commit moves the completed part file to target atomically
+func (c *Client) commit(part, target string, mode os.FileMode) error {
+	if c.become {
+		return c.installFile(part, target, mode)
+	}
+	return c.withSFTP(func(cli *sftp.Client) error {
+		if err := cli.Chmod(part, mode); err != nil {
+			return err
+		}
+		err := cli.PosixRename(part, target)
+		if err == nil {
+			return nil
+		}
+		// server without posix-rename extension
+		_ = cli.Remove(target)
+		return cli.Rename(part, target)
+	})
+}
@@ -0,0 +1,64 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godzilla-s/k3s-installer/pkg/client/kube"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+func TestPullChart(t *testing.T) {
+	repoDir := t.TempDir()
+	pkg, err := chartutil.Save(&chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "demo", Version: "1.2.3"},
+	}, repoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.FileServer(http.Dir(repoDir)))
+	defer server.Close()
+
+	index := repo.NewIndexFile()
+	err = index.MustAdd(&chart.Metadata{APIVersion: chart.APIVersionV2, Name: "demo", Version: "1.2.3"},
+		filepath.Base(pkg), server.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = index.WriteFile(filepath.Join(repoDir, "index.yaml"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workDir := t.TempDir()
+	cacheFile := filepath.Join(workDir, "charts", "demo", "demo-1.2.3.tgz")
+	src := &kube.ChartSource{Repo: server.URL, Chart: "demo", Version: "1.2.3"}
+	err = kube.PullChart(src, cacheFile, filepath.Join(workDir, "helm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := loader.LoadFile(cacheFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch.Metadata.Version != "1.2.3" {
+		t.Fatalf("unexpected chart version %s", ch.Metadata.Version)
+	}
+
+	// the cached chart is used without repo
+	server.Close()
+	err = kube.PullChart(src, cacheFile, filepath.Join(workDir, "helm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(cacheFile); err != nil {
+		t.Fatal(err)
+	}
+}
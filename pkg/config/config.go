@@ -1,10 +1,7 @@
 package config
 
 import (
-	"os"
 	"time"
-
-	"gopkg.in/yaml.v3"
 )
 
 type Chart struct {
@@ -13,7 +10,23 @@ type Chart struct {
 	Version     string        `yaml:"version"`
 	Namespace   string        `yaml:"namespace"`
 	Timeout     time.Duration `yaml:"timeout"`
-	SetValues   []string      `yaml:"setValues"`
+	// Repo is a helm repository like https://charts.example.com or an oci registry like
+	// oci://registry.example.com/charts, the pulled chart is cached at Path for the next run
+	Repo string `yaml:"repo"`
+	// Chart is the chart name in Repo, default the chart key
+	Chart                 string `yaml:"chart"`
+	Username              string `yaml:"username"`
+	Password              string `yaml:"password"`
+	CaFile                string `yaml:"caFile"`
+	InsecureSkipTLSVerify bool   `yaml:"insecureSkipTLSVerify"`
+	// ValuesFiles are merged in order, the later one overrides the former like helm -f
+	ValuesFiles []string `yaml:"valuesFiles"`
+	// Values overrides the values files
+	Values map[string]interface{} `yaml:"values"`
+	// SetValues, SetString and SetFile override the values like helm --set, --set-string and --set-file
+	SetValues []string `yaml:"setValues"`
+	SetString []string `yaml:"setString"`
+	SetFile   []string `yaml:"setFile"`
 }
 
 type Package struct {
@@ -32,6 +45,56 @@ type Settings struct {
 	Cluster    Cluster
 	HaIP       string      `yaml:"haIP"`
 	Registries []*Registry `yaml:"registries"`
+	SSH        SSH         `yaml:"ssh"`
+	Bastion    []*Bastion  `yaml:"bastion"`
+	Firewall   Firewall    `yaml:"firewall"`
+	Hosts      Hosts       `yaml:"hosts"`
+	// Token is the shared secret to join servers and agents, it is generated if not given
+	Token string `yaml:"token"`
+	// AgentToken is used by agents to join the cluster instead of Token if it is given
+	AgentToken string `yaml:"agentToken"`
+	// Force continues installing even if preflight finds conflicts, it is set by --force
+	Force bool `yaml:"-"`
+}
+
+// Hosts defines the managed block of /etc/hosts on every node
+type Hosts struct {
+	// Manage writes all cluster nodes and the ha IP into /etc/hosts
+	Manage bool `yaml:"manage"`
+	// HaHostname is the name of ha IP in /etc/hosts
+	HaHostname string `yaml:"haHostname"`
+}
+
+// Firewall defines how the firewall of nodes is handled
+type Firewall struct {
+	// Mode is one of manage, disable and skip, default manage
+	Mode string `yaml:"mode"`
+}
+
+// Bastion is a jump host to reach the nodes, multiple bastions are connected in order
+type Bastion struct {
+	Address    string `yaml:"address"`
+	SSHPort    int    `yaml:"sshPort"`
+	User       string `yaml:"user"`
+	Password   string `yaml:"password"`
+	PrivateKey string `yaml:"privateKey"`
+	Passphrase string `yaml:"passphrase"`
+	UseAgent   *bool  `yaml:"useAgent"`
+	HostKey    string `yaml:"hostKeyFingerprint"`
+}
+
+// SSH is the default ssh auth of nodes, a node can override it by itself
+type SSH struct {
+	User           string `yaml:"user"`
+	PrivateKey     string `yaml:"privateKey"`
+	Passphrase     string `yaml:"passphrase"`
+	UseAgent       bool   `yaml:"useAgent"`
+	Become         bool   `yaml:"become"`
+	BecomePassword string `yaml:"becomePassword"`
+	// KnownHosts are known_hosts files used to verify host keys, default ~/.ssh/known_hosts
+	KnownHosts          []string `yaml:"knownHosts"`
+	HostKeyPolicy       string   `yaml:"hostKeyPolicy"`
+	InsecureSkipHostKey bool     `yaml:"insecureSkipHostKey"`
 }
 
 type K3SConfig struct {
@@ -41,23 +104,58 @@ type K3SConfig struct {
 	DisableLocalPath bool `yaml:"disableLocalPath"`
 }
 
+// Registry is a private registry, it is written into /etc/rancher/k3s/registries.yaml on every node
 type Registry struct {
-	Address  string `yaml:"address"`
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
-	CaCert   string `yaml:"cacert"`
+	// Address is the host of registry, the scheme is https unless it is given like http://host:port
+	Address string `yaml:"address"`
+	// Mirrors are the upstream registries like docker.io which are pulled from this registry
+	Mirrors []string `yaml:"mirrors"`
+	// Rewrites maps the image name by regexp before pulling from this registry
+	Rewrites map[string]string `yaml:"rewrites"`
+	Username string            `yaml:"username"`
+	Password string            `yaml:"password"`
+	// CaCert, Cert and Key are local files, they are uploaded to the nodes
+	CaCert             string `yaml:"cacert"`
+	Cert               string `yaml:"cert"`
+	Key                string `yaml:"key"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
 }
 
 type Node struct {
 	Address         string      `yaml:"address"`
 	SSHPort         int         `yaml:"sshPort"`
+	HostKey         string      `yaml:"hostKeyFingerprint"`
+	User            string      `yaml:"user"`
 	RootPassword    string      `yaml:"rootPassword"`
+	Become          *bool       `yaml:"become"`
+	BecomePassword  string      `yaml:"becomePassword"`
+	PrivateKey      string      `yaml:"privateKey"`
+	Passphrase      string      `yaml:"passphrase"`
+	UseAgent        *bool       `yaml:"useAgent"`
 	Hostname        string      `yaml:"hostname"`
 	Role            string      `yaml:"role"`
 	OS              string      `yaml:"os"`
 	Requirement     Requirement `yaml:"requirement"`
 	InstallPackages []string    `yaml:"installPackages"`
 	PreloadImages   []string    `yaml:"preloadImages"`
+	Bastion         []*Bastion  `yaml:"bastion"`
+	// Sysctls are applied together with the sysctls required by k3s, they override the defaults
+	Sysctls map[string]string `yaml:"sysctls"`
+	K3S     NodeK3SConfig     `yaml:"k3s"`
+}
+
+// NodeK3SConfig is the k3s config of a single node, it is written into /etc/rancher/k3s/config.yaml
+type NodeK3SConfig struct {
+	// NodeIP and NodeExternalIP may be comma separated for dual stack
+	NodeIP            string   `yaml:"nodeIP"`
+	NodeExternalIP    string   `yaml:"nodeExternalIP"`
+	FlannelIface      string   `yaml:"flannelIface"`
+	NodeLabels        []string `yaml:"nodeLabels"`
+	NodeTaints        []string `yaml:"nodeTaints"`
+	KubeletArgs       []string `yaml:"kubeletArgs"`
+	KubeApiserverArgs []string `yaml:"kubeApiserverArgs"`
+	// ExtraConfig is merged into config.yaml, it overrides the options generated by installer
+	ExtraConfig map[string]interface{} `yaml:"extraConfig"`
 }
 
 type Requirement struct {
@@ -80,6 +178,10 @@ type Config struct {
 	Nodes    map[string]*Node    `yaml:"nodes"`
 	Settings Settings            `yaml:"settings"`
 	Steps    []*Step             `yaml:"steps"`
+	// secretsKey decrypts the encrypted secrets in config
+	secretsKey string
+	// profiles are the overlays merged on top of config
+	profiles []string
 }
 
 type Cluster struct {
@@ -87,14 +189,45 @@ type Cluster struct {
 	Worker []string `yaml:"worker"`
 }
 
-func Parse(configFile string) (*Config, error) {
-	data, err := os.ReadFile(configFile)
-	if err != nil {
-		return nil, err
+// ParseOption customizes how the config is parsed
+type ParseOption func(*Config)
+
+// WithProfiles merges the named profiles in order on top of the config
+func WithProfiles(profiles ...string) ParseOption {
+	return func(c *Config) {
+		c.profiles = append(c.profiles, profiles...)
 	}
+}
+
+// WithSecretsKey sets the key to decrypt the encrypted secrets
+func WithSecretsKey(key string) ParseOption {
+	return func(c *Config) {
+		c.secretsKey = key
+	}
+}
+
+// Parse reads the config file with the files it includes, then merges the profiles on top of it
+func Parse(configFile string, options ...ParseOption) (*Config, error) {
 	var config Config
+	for _, option := range options {
+		option(&config)
+	}
 
-	err = yaml.Unmarshal(data, &config)
+	l := &loader{}
+	root, err := l.load(configFile)
+	if err != nil {
+		return nil, err
+	}
+	// check before the profiles are merged, so the profiles not selected are checked as well
+	err = l.checkFields(root)
+	if err != nil {
+		return nil, err
+	}
+	root, err = applyProfiles(root, config.profiles)
+	if err != nil {
+		return nil, err
+	}
+	err = root.Decode(&config)
 	if err != nil {
 		return nil, err
 	}
@@ -5,10 +5,32 @@ const (
 	PackageDirectory     = "directory"
 	PackageDockerService = "docker"
 	PackageRPM           = "rpm"
+	PackageDeb           = "deb"
 	PackageKernel        = "kernel"
 )
 
 const (
+	// FirewallManage opens the k3s ports in the firewall and closes them on uninstall
+	FirewallManage = "manage"
+	// FirewallDisable stops the firewall
+	FirewallDisable = "disable"
+	// FirewallSkip leaves the firewall untouched
+	FirewallSkip = "skip"
+)
+
+const (
+	HostKeyPolicyStrict = "strict"
+	HostKeyPolicyTOFU   = "tofu"
+)
+
+const (
+	// WorkspaceDir holds the state of installer under root path
+	WorkspaceDir = ".k3s-installer"
+
+	DefaultKnownHosts = "~/.ssh/known_hosts"
+
+	DefaultHaHostname = "k3s-api"
+
 	DefaultK3SConfigPath = "/etc/rancher/k3s"
 
 	DefaultK3SLoadImagePath = "/var/lib/rancher/k3s/agent/images"
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError is an error at the position of a config file
+type FieldError struct {
+	File   string
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *FieldError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Msg)
+}
+
+// Errors are all the errors found in config, they are reported together
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// add appends err, the errors of a nested Errors are flattened
+func (e *Errors) add(err error) {
+	switch err := err.(type) {
+	case nil:
+	case Errors:
+		*e = append(*e, err...)
+	default:
+		*e = append(*e, err)
+	}
+}
+
+// err returns nil if there is no error, so it can be compared with nil
+func (e Errors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// includeKey lists the files merged before the config itself, relative to the including file
+	includeKey = "include"
+	// profilesKey defines the named overlays which are merged on top of the config by --profile
+	profilesKey = "profiles"
+)
+
+// loader reads a config file together with the files it includes
+type loader struct {
+	// loading is the stack of files being loaded to detect include cycles
+	loading []string
+	// files records the file of every node to report the errors
+	files map[*yaml.Node]string
+}
+
+// load reads file and merges the included files in order, the file itself is merged last so
+// it overrides what it includes
+func (l *loader) load(file string) (*yaml.Node, error) {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range l.loading {
+		if f == file {
+			return nil, fmt.Errorf("include cycle: %s is included by itself", file)
+		}
+	}
+	l.loading = append(l.loading, file)
+	defer func() { l.loading = l.loading[:len(l.loading)-1] }()
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err = yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	l.record(&doc, file)
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: config must be a mapping", file)
+	}
+
+	includes := removeKey(root, includeKey)
+	if includes == nil {
+		return root, nil
+	}
+	var files []string
+	if err = includes.Decode(&files); err != nil {
+		return nil, fmt.Errorf("%s: invalid include: %v", file, err)
+	}
+	var merged *yaml.Node
+	for _, include := range files {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(file), include)
+		}
+		node, err := l.load(include)
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeNode(merged, node)
+	}
+	return mergeNode(merged, root), nil
+}
+
+func (l *loader) record(node *yaml.Node, file string) {
+	if l.files == nil {
+		l.files = make(map[*yaml.Node]string)
+	}
+	l.files[node] = file
+	for _, child := range node.Content {
+		l.record(child, file)
+	}
+}
+
+// applyProfiles merges the named profiles on top of root in order
+func applyProfiles(root *yaml.Node, names []string) (*yaml.Node, error) {
+	profiles := removeKey(root, profilesKey)
+	for _, name := range names {
+		var profile *yaml.Node
+		if profiles != nil && profiles.Kind == yaml.MappingNode {
+			profile = findKey(profiles, name)
+		}
+		if profile == nil {
+			return nil, fmt.Errorf("profile %s not defined", name)
+		}
+		if profile.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("profile %s must be a mapping", name)
+		}
+		root = mergeNode(root, profile)
+	}
+	return root, nil
+}
+
+// mergeNode deep merges overlay into base, mappings are merged by key and the others like lists
+// are replaced. A null value in overlay removes the key from base.
+func mergeNode(base, overlay *yaml.Node) *yaml.Node {
+	if base == nil {
+		return overlay
+	}
+	if base.Kind != yaml.MappingNode || overlay.Kind != yaml.MappingNode {
+		return overlay
+	}
+	merged := *base
+	merged.Content = append([]*yaml.Node(nil), base.Content...)
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		key, value := overlay.Content[i], overlay.Content[i+1]
+		j := keyIndex(&merged, key.Value)
+		switch {
+		case value.Tag == "!!null":
+			if j >= 0 {
+				merged.Content = append(merged.Content[:j], merged.Content[j+2:]...)
+			}
+		case j >= 0:
+			merged.Content[j+1] = mergeNode(merged.Content[j+1], value)
+		default:
+			merged.Content = append(merged.Content, key, value)
+		}
+	}
+	return &merged
+}
+
+func keyIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func findKey(mapping *yaml.Node, key string) *yaml.Node {
+	if i := keyIndex(mapping, key); i >= 0 {
+		return mapping.Content[i+1]
+	}
+	return nil
+}
+
+// removeKey removes key from mapping and returns its value
+func removeKey(mapping *yaml.Node, key string) *yaml.Node {
+	i := keyIndex(mapping, key)
+	if i < 0 {
+		return nil
+	}
+	value := mapping.Content[i+1]
+	mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+	return value
+}
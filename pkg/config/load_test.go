@@ -0,0 +1,256 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func parseYAML(t *testing.T, data string) *yaml.Node {
+	t.Helper()
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(data), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc.Content[0]
+}
+
+// equalYAML compares the node with the yaml text regardless of formatting
+func equalYAML(t *testing.T, node *yaml.Node, want string) bool {
+	t.Helper()
+	var got, expect interface{}
+	if err := node.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal([]byte(want), &expect); err != nil {
+		t.Fatal(err)
+	}
+	gotData, _ := yaml.Marshal(got)
+	wantData, _ := yaml.Marshal(expect)
+	return string(gotData) == string(wantData)
+}
+
+func TestMergeNode(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		overlay string
+		want    string
+	}{
+		{
+			name:    "new key",
+			base:    "a: 1",
+			overlay: "b: 2",
+			want:    "{a: 1, b: 2}",
+		},
+		{
+			name:    "scalar replaced",
+			base:    "a: 1",
+			overlay: "a: 2",
+			want:    "a: 2",
+		},
+		{
+			name:    "nested mapping merged",
+			base:    "settings: {haIP: 10.0.0.1, ssh: {user: root, become: false}}",
+			overlay: "settings: {ssh: {become: true}}",
+			want:    "settings: {haIP: 10.0.0.1, ssh: {user: root, become: true}}",
+		},
+		{
+			name:    "list replaced",
+			base:    "master: [node1, node2]",
+			overlay: "master: [node3]",
+			want:    "master: [node3]",
+		},
+		{
+			name:    "null removes key",
+			base:    "{a: 1, b: 2}",
+			overlay: "b: null",
+			want:    "a: 1",
+		},
+		{
+			name:    "null of missing key",
+			base:    "a: 1",
+			overlay: "b: ~",
+			want:    "a: 1",
+		},
+		{
+			name:    "mapping replaced by scalar",
+			base:    "a: {b: 1}",
+			overlay: "a: 2",
+			want:    "a: 2",
+		},
+	}
+	for _, tt := range tests {
+		base := parseYAML(t, tt.base)
+		before, _ := yaml.Marshal(base)
+		got := mergeNode(base, parseYAML(t, tt.overlay))
+		if !equalYAML(t, got, tt.want) {
+			out, _ := yaml.Marshal(got)
+			t.Errorf("%s: mergeNode() = %s, want %s", tt.name, out, tt.want)
+		}
+		if after, _ := yaml.Marshal(base); string(after) != string(before) {
+			t.Errorf("%s: mergeNode() modifies base", tt.name)
+		}
+	}
+	if got := mergeNode(nil, parseYAML(t, "a: 1")); !equalYAML(t, got, "a: 1") {
+		t.Errorf("mergeNode() with nil base does not return overlay")
+	}
+}
+
+func TestApplyProfiles(t *testing.T) {
+	const config = `
+settings:
+  haIP: 10.0.0.1
+  ssh:
+    user: root
+profiles:
+  dev:
+    settings:
+      haIP: 10.0.0.2
+  sudo:
+    settings:
+      ssh:
+        user: admin
+        become: true
+  invalid: [a]
+`
+	tests := []struct {
+		name     string
+		profiles []string
+		want     string
+		wantErr  string
+	}{
+		{
+			name: "no profile",
+			want: "settings: {haIP: 10.0.0.1, ssh: {user: root}}",
+		},
+		{
+			name:     "one profile",
+			profiles: []string{"dev"},
+			want:     "settings: {haIP: 10.0.0.2, ssh: {user: root}}",
+		},
+		{
+			name:     "profiles in order",
+			profiles: []string{"dev", "sudo"},
+			want:     "settings: {haIP: 10.0.0.2, ssh: {user: admin, become: true}}",
+		},
+		{
+			name:     "undefined profile",
+			profiles: []string{"prod"},
+			wantErr:  "profile prod not defined",
+		},
+		{
+			name:     "profile not mapping",
+			profiles: []string{"invalid"},
+			wantErr:  "profile invalid must be a mapping",
+		},
+	}
+	for _, tt := range tests {
+		got, err := applyProfiles(parseYAML(t, config), tt.profiles)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s: applyProfiles() error = %v, want %s", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: applyProfiles() error = %v", tt.name, err)
+			continue
+		}
+		if !equalYAML(t, got, tt.want) {
+			out, _ := yaml.Marshal(got)
+			t.Errorf("%s: applyProfiles() = %s, want %s", tt.name, out, tt.want)
+		}
+	}
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadInclude(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "included in order and overridden by the file itself",
+			files: map[string]string{
+				"config.yaml":         "include: [base/common.yaml, site.yaml]\nsettings: {haIP: 10.0.0.3}",
+				"base/common.yaml":    "include: [nodes.yaml]\nsettings: {haIP: 10.0.0.1, rootPath: /opt}",
+				"base/nodes.yaml":     "nodes: {node1: {address: 10.0.0.11}}",
+				"site.yaml":           "settings: {haIP: 10.0.0.2, rootPath: /data}",
+				"unused/ignored.yaml": "settings: {haIP: 10.0.0.4}",
+			},
+			want: "{nodes: {node1: {address: 10.0.0.11}}, settings: {haIP: 10.0.0.3, rootPath: /data}}",
+		},
+		{
+			name:  "empty file",
+			files: map[string]string{"config.yaml": ""},
+			want:  "{}",
+		},
+		{
+			name: "include cycle",
+			files: map[string]string{
+				"config.yaml": "include: [a.yaml]",
+				"a.yaml":      "include: [b.yaml]",
+				"b.yaml":      "include: [a.yaml]",
+			},
+			wantErr: "include cycle",
+		},
+		{
+			name:    "include itself",
+			files:   map[string]string{"config.yaml": "include: [config.yaml]"},
+			wantErr: "include cycle",
+		},
+		{
+			name:    "missing include",
+			files:   map[string]string{"config.yaml": "include: [missing.yaml]"},
+			wantErr: "no such file",
+		},
+		{
+			name:    "invalid include",
+			files:   map[string]string{"config.yaml": "include: {a: b}"},
+			wantErr: "invalid include",
+		},
+		{
+			name:    "not mapping",
+			files:   map[string]string{"config.yaml": "- a"},
+			wantErr: "config must be a mapping",
+		},
+	}
+	for _, tt := range tests {
+		dir := writeFiles(t, tt.files)
+		got, err := (&loader{}).load(filepath.Join(dir, "config.yaml"))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: load() error = %v, want %s", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: load() error = %v", tt.name, err)
+			continue
+		}
+		if !equalYAML(t, got, tt.want) {
+			out, _ := yaml.Marshal(got)
+			t.Errorf("%s: load() = %s, want %s", tt.name, out, tt.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const schemaDraft = "http://json-schema.org/draft-07/schema#"
+
+const (
+	durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+	capacityPattern = `^\s*[0-9.]+\s*([KkMmGgTtBb]|[KMGT]i|[KMGT]B)?\s*$`
+	kernelPattern   = `^\s*[0-9]+(\.[0-9]+)*([-+_ ].*)?$`
+)
+
+// Schema is a JSON Schema of config, it is generated from the config structs
+type Schema struct {
+	Schema      string             `json:"$schema,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	// AdditionalProperties is the schema of map values, nil for struct which forbids unknown fields
+	AdditionalProperties *Schema  `json:"-"`
+	Items                *Schema  `json:"items,omitempty"`
+	Enum                 []string `json:"enum,omitempty"`
+	Pattern              string   `json:"pattern,omitempty"`
+}
+
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	type schema Schema
+	out := struct {
+		*schema
+		AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+	}{schema: (*schema)(s)}
+	switch {
+	case s.AdditionalProperties != nil:
+		out.AdditionalProperties = s.AdditionalProperties
+	case s.Type == "object" && s.Properties != nil:
+		out.AdditionalProperties = false
+	}
+	// keep <> of descriptions readable
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(out); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// schemaFields describes the fields by <struct>.<yaml name>, they are added to the generated schema
+var schemaFields = map[string]Schema{
+	"Config.charts":   {Description: "helm charts by name, they are installed by the chart steps"},
+	"Config.packages": {Description: "packages by name, they are installed on the nodes which list them in installPackages"},
+	"Config.images":   {Description: "image tarballs by name, they are preloaded on the nodes which list them in preloadImages"},
+	"Config.nodes":    {Description: "nodes by name, the names are referenced by settings.cluster"},
+	"Config.steps":    {Description: "install steps in order"},
+
+	"Chart.path":                  {Description: "directory of <name>-<version>.tgz relative to rootPath, default charts/<name>"},
+	"Chart.releaseName":           {Description: "helm release name, default the chart name"},
+	"Chart.namespace":             {Description: "namespace of release, default default"},
+	"Chart.timeout":               {Description: "timeout to wait for the release ready, like 2m"},
+	"Chart.repo":                  {Description: "helm repository like https://charts.example.com or oci registry like oci://registry/charts"},
+	"Chart.chart":                 {Description: "chart name in repo, default the chart key"},
+	"Chart.password":              {Description: "base64 encoded password or a secret reference"},
+	"Chart.valuesFiles":           {Description: "values files merged in order, relative to rootPath"},
+	"Chart.values":                {Description: "inline values which override valuesFiles"},
+	"Chart.setValues":             {Description: "values like helm --set"},
+	"Chart.setString":             {Description: "values like helm --set-string"},
+	"Chart.setFile":               {Description: "values like helm --set-file, the files are relative to rootPath"},
+	"Chart.insecureSkipTLSVerify": {Description: "skip verifying the certificate of repo"},
+
+	"Package.type":   {Description: "package type", Enum: []string{PackageFile, PackageDirectory, PackageDockerService, PackageRPM, PackageDeb}},
+	"Package.path":   {Description: "file or directory relative to rootPath, rpm and deb packages are directories of the packages"},
+	"Package.target": {Description: "target directory on node of directory package"},
+
+	"Image.path": {Description: "image tarball relative to rootPath"},
+
+	"Settings.rootPath":   {Description: "directory of the files referenced by config, default the current directory"},
+	"Settings.haIP":       {Description: "IP address of kubernetes api, agents join the cluster by it"},
+	"Settings.token":      {Description: "token to join servers and agents, generated if empty, it can be a secret reference"},
+	"Settings.agentToken": {Description: "token of agents to join the cluster, default token"},
+	"Settings.bastion":    {Description: "jump hosts to reach the nodes in order"},
+
+	"Firewall.mode":    {Description: "manage opens the k3s ports, disable stops the firewall, skip does nothing", Enum: []string{FirewallManage, FirewallDisable, FirewallSkip}},
+	"Hosts.manage":     {Description: "write all nodes and haIP into /etc/hosts of every node"},
+	"Hosts.haHostname": {Description: "hostname of haIP in /etc/hosts, default " + DefaultHaHostname},
+
+	"SSH.hostKeyPolicy":       {Description: "strict requires the host key in knownHosts, tofu records unknown host keys", Enum: []string{HostKeyPolicyStrict, HostKeyPolicyTOFU}},
+	"SSH.become":              {Description: "run commands with sudo when user is not root"},
+	"SSH.becomePassword":      {Description: "base64 encoded sudo password or a secret reference, default the login password"},
+	"SSH.insecureSkipHostKey": {Description: "skip verifying host keys"},
+
+	"Bastion.password":           {Description: "base64 encoded password or a secret reference"},
+	"Bastion.hostKeyFingerprint": {Description: "pinned host key fingerprint like SHA256:..."},
+
+	"Registry.address":  {Description: "registry host, https unless the scheme is given like http://host:port"},
+	"Registry.mirrors":  {Description: "upstream registries like docker.io pulled from this registry"},
+	"Registry.rewrites": {Description: "image name rewrites by regexp"},
+	"Registry.password": {Description: "base64 encoded password or a secret reference"},
+	"Registry.cacert":   {Description: "CA file relative to rootPath, uploaded to nodes"},
+	"Registry.cert":     {Description: "client certificate relative to rootPath, uploaded to nodes"},
+	"Registry.key":      {Description: "client key relative to rootPath, uploaded to nodes"},
+
+	"Node.address":            {Description: "address to connect node by ssh"},
+	"Node.hostKeyFingerprint": {Description: "pinned host key fingerprint like SHA256:..."},
+	"Node.user":               {Description: "login user, default settings.ssh.user or root"},
+	"Node.rootPassword":       {Description: "base64 encoded login password or a secret reference"},
+	"Node.becomePassword":     {Description: "base64 encoded sudo password or a secret reference"},
+	"Node.hostname":           {Description: "hostname set on node, it must be a lowercase RFC 1123 name"},
+	"Node.os":                 {Description: "os expected on node like centos or ubuntu, checked against /etc/os-release"},
+	"Node.installPackages":    {Description: "names of packages installed on node"},
+	"Node.preloadImages":      {Description: "names of images preloaded on node"},
+	"Node.bastion":            {Description: "jump hosts of node, default settings.bastion"},
+	"Node.sysctls":            {Description: "sysctls applied on node, they override the defaults required by k3s"},
+	"Node.k3s":                {Description: "options of /etc/rancher/k3s/config.yaml of node"},
+
+	"NodeK3SConfig.nodeIP":            {Description: "node-ip, comma separated for dual stack"},
+	"NodeK3SConfig.nodeExternalIP":    {Description: "node-external-ip, comma separated for dual stack"},
+	"NodeK3SConfig.nodeLabels":        {Description: "node-label like key=value"},
+	"NodeK3SConfig.nodeTaints":        {Description: "node-taint like key=value:NoSchedule"},
+	"NodeK3SConfig.kubeApiserverArgs": {Description: "kube-apiserver-arg, only available on master"},
+	"NodeK3SConfig.extraConfig":       {Description: "merged into config.yaml as is, it overrides the options above"},
+
+	"Requirement.kernelVersion": {Description: "minimal kernel version like 5.4", Pattern: kernelPattern},
+	"Requirement.cpu":           {Description: "minimal number of cpu"},
+	"Requirement.memory":        {Description: "minimal memory like 4Gi", Pattern: capacityPattern},
+	"Requirement.storage":       {Description: "minimal free space of /var/lib/rancher like 50Gi", Pattern: capacityPattern},
+
+	"Step.type":     {Description: "step type", Enum: []string{"k3s", "chart"}},
+	"Step.charts":   {Description: "names of charts installed in order"},
+	"Step.manifest": {Description: "manifest files applied in order"},
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+var (
+	configSchema     *Schema
+	configSchemaOnce sync.Once
+)
+
+// JSONSchema returns the schema of config file
+func JSONSchema() *Schema {
+	configSchemaOnce.Do(func() {
+		configSchema = schemaOf(reflect.TypeOf(Config{}))
+		configSchema.Schema = schemaDraft
+		configSchema.Title = "k3s-installer config"
+		configSchema.Properties[includeKey] = &Schema{
+			Description: "config files merged before this file in order, relative to this file",
+			Type:        "array",
+			Items:       &Schema{Type: "string"},
+		}
+		configSchema.Properties[profilesKey] = &Schema{
+			Description:          "overlays merged on top of config by --profile",
+			Type:                 "object",
+			AdditionalProperties: &Schema{Ref: "#"},
+		}
+	})
+	return configSchema
+}
+
+func schemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == durationType {
+		return &Schema{Type: "string", Pattern: durationPattern}
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+		for name, field := range yamlFields(t) {
+			fs := schemaOf(field.Type)
+			if extra, ok := schemaFields[t.Name()+"."+name]; ok {
+				fs.Description = extra.Description
+				if extra.Enum != nil {
+					fs.Enum = extra.Enum
+				}
+				if extra.Pattern != "" {
+					fs.Pattern = extra.Pattern
+				}
+			}
+			s.Properties[name] = fs
+		}
+		return s
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(t.Elem())}
+	case reflect.Slice:
+		return &Schema{Type: "array", Items: schemaOf(t.Elem())}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	}
+	// interface accepts any value
+	return &Schema{}
+}
+
+// yamlFields returns the fields of struct by the name in yaml
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field
+	}
+	return fields
+}
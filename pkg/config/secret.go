@@ -0,0 +1,124 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// a credential in config can be a secret reference instead of the value itself
+const (
+	// SecretEnvPrefix reads the secret from environment variable, like env:REGISTRY_PASSWORD
+	SecretEnvPrefix = "env:"
+	// SecretFilePrefix reads the secret from a file relative to root path, like file:secrets/token
+	SecretFilePrefix = "file:"
+	// SecretEncryptedPrefix is a secret encrypted by `secret encrypt`, it is decrypted with the secrets key
+	SecretEncryptedPrefix = "enc:"
+)
+
+const (
+	secretSaltSize = 16
+	secretKeySize  = 32
+)
+
+// IsSecretRef tells whether the value is a secret reference
+func IsSecretRef(value string) bool {
+	return strings.HasPrefix(value, SecretEnvPrefix) ||
+		strings.HasPrefix(value, SecretFilePrefix) ||
+		strings.HasPrefix(value, SecretEncryptedPrefix)
+}
+
+// resolveSecret returns the secret which value refers to, value is returned as is if it is not a reference
+func (c *Config) resolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, SecretEnvPrefix):
+		name := strings.TrimPrefix(value, SecretEnvPrefix)
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, SecretFilePrefix):
+		data, err := os.ReadFile(c.resolvePath(strings.TrimPrefix(value, SecretFilePrefix)))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case strings.HasPrefix(value, SecretEncryptedPrefix):
+		if c.secretsKey == "" {
+			return "", fmt.Errorf("missing secrets key to decrypt secret")
+		}
+		return DecryptSecret(value, c.secretsKey)
+	}
+	return value, nil
+}
+
+// decodePassword resolves the password if it is a secret reference, otherwise it is base64 encoded
+func (c *Config) decodePassword(value string) (string, error) {
+	if IsSecretRef(value) {
+		return c.resolveSecret(value)
+	}
+	decPwd, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid password")
+	}
+	return string(decPwd), nil
+}
+
+// EncryptSecret encrypts the secret with AES-GCM, the AES key is derived from key by scrypt
+func EncryptSecret(secret, key string) (string, error) {
+	salt := make([]byte, secretSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	aead, err := newSecretCipher(key, salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+	data := append(salt, nonce...)
+	data = aead.Seal(data, nonce, []byte(secret), nil)
+	return SecretEncryptedPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// DecryptSecret decrypts the secret encrypted by EncryptSecret
+func DecryptSecret(value, key string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, SecretEncryptedPrefix))
+	if err != nil || len(data) < secretSaltSize {
+		return "", fmt.Errorf("invalid encrypted secret")
+	}
+	aead, err := newSecretCipher(key, data[:secretSaltSize])
+	if err != nil {
+		return "", err
+	}
+	data = data[secretSaltSize:]
+	if len(data) < aead.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted secret")
+	}
+	secret, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("fail to decrypt secret: wrong secrets key or corrupted secret")
+	}
+	return string(secret), nil
+}
+
+func newSecretCipher(key string, salt []byte) (cipher.AEAD, error) {
+	aesKey, err := scrypt.Key([]byte(key), salt, 1<<15, 8, 1, secretKeySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptSecret(t *testing.T) {
+	encrypted, err := EncryptSecret("s3cret", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encrypted, SecretEncryptedPrefix) {
+		t.Fatalf("encrypted secret %s has no prefix %s", encrypted, SecretEncryptedPrefix)
+	}
+	again, err := EncryptSecret("s3cret", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == encrypted {
+		t.Errorf("encrypting twice gives the same secret, salt or nonce is not random")
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{name: "right key", value: encrypted, key: "key", want: "s3cret"},
+		{name: "wrong key", value: encrypted, key: "other", wantErr: true},
+		{name: "not base64", value: "enc:???", key: "key", wantErr: true},
+		{name: "too short", value: "enc:YWJj", key: "key", wantErr: true},
+		{name: "corrupted", value: encrypted[:len(encrypted)-4] + "AAAA", key: "key", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := DecryptSecret(tt.value, tt.key)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: DecryptSecret() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: DecryptSecret() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "token"), []byte("t0ken\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("K3S_INSTALLER_TEST_SECRET", "from-env")
+	encrypted, err := EncryptSecret("from-enc", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		value      string
+		secretsKey string
+		want       string
+		wantErr    bool
+	}{
+		{name: "plain", value: "plain", want: "plain"},
+		{name: "env", value: "env:K3S_INSTALLER_TEST_SECRET", want: "from-env"},
+		{name: "env not set", value: "env:K3S_INSTALLER_TEST_UNSET", wantErr: true},
+		{name: "file relative to root path", value: "file:token", want: "t0ken"},
+		{name: "absolute file", value: "file:" + filepath.Join(root, "token"), want: "t0ken"},
+		{name: "missing file", value: "file:missing", wantErr: true},
+		{name: "encrypted", value: encrypted, secretsKey: "key", want: "from-enc"},
+		{name: "encrypted without key", value: encrypted, wantErr: true},
+	}
+	for _, tt := range tests {
+		c := &Config{secretsKey: tt.secretsKey}
+		c.Settings.RootPath = root
+		got, err := c.resolveSecret(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: resolveSecret() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: resolveSecret() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodePassword(t *testing.T) {
+	t.Setenv("K3S_INSTALLER_TEST_PASSWORD", "from-env")
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "base64", value: "cGFzc3dvcmQ=", want: "password"},
+		{name: "empty", value: "", want: ""},
+		{name: "invalid base64", value: "not base64!", wantErr: true},
+		{name: "secret reference", value: "env:K3S_INSTALLER_TEST_PASSWORD", want: "from-env"},
+	}
+	for _, tt := range tests {
+		got, err := (&Config{}).decodePassword(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: decodePassword() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: decodePassword() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
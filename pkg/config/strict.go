@@ -0,0 +1,171 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/godzilla-s/k3s-installer/pkg/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// checkFields validates the config against JSONSchema, it reports the unknown fields, the values
+// of wrong type and the values out of enum or pattern. yaml.Node.Decode drops unknown fields
+// silently and stops at the first error.
+func (l *loader) checkFields(root *yaml.Node) error {
+	var errs Errors
+	l.checkNode(root, nil, JSONSchema(), &errs)
+	return errs.err()
+}
+
+func (l *loader) checkNode(node, key *yaml.Node, schema *Schema, errs *Errors) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Tag == "!!null" {
+		return
+	}
+	if schema.Ref == "#" {
+		schema = JSONSchema()
+	}
+
+	switch schema.Type {
+	case "":
+		// any value
+	case "object":
+		if node.Kind != yaml.MappingNode {
+			errs.add(l.errorf(node, key, "expect a mapping"))
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k := node.Content[i]
+			if schema.AdditionalProperties != nil {
+				l.checkNode(node.Content[i+1], k, schema.AdditionalProperties, errs)
+				continue
+			}
+			field, ok := schema.Properties[k.Value]
+			if !ok {
+				errs.add(l.errorf(k, nil, "unknown field '%s'%s", k.Value, suggest(k.Value, schema.Properties)))
+				continue
+			}
+			l.checkNode(node.Content[i+1], k, field, errs)
+		}
+	case "array":
+		if node.Kind != yaml.SequenceNode {
+			errs.add(l.errorf(node, key, "expect a list"))
+			return
+		}
+		for _, item := range node.Content {
+			l.checkNode(item, nil, schema.Items, errs)
+		}
+	default:
+		l.checkScalar(node, key, schema, errs)
+	}
+}
+
+// scalarTags are the yaml tags accepted by the scalar types of schema
+var scalarTags = map[string][]string{
+	"boolean": {"!!bool"},
+	"integer": {"!!int"},
+	"number":  {"!!int", "!!float"},
+}
+
+func (l *loader) checkScalar(node, key *yaml.Node, schema *Schema, errs *Errors) {
+	if node.Kind != yaml.ScalarNode {
+		errs.add(l.errorf(node, key, "expect type %s", schema.Type))
+		return
+	}
+	if tags, ok := scalarTags[schema.Type]; ok && !contains(tags, node.ShortTag()) {
+		errs.add(l.errorf(node, nil, "invalid value '%s', expect type %s", node.Value, schema.Type))
+		return
+	}
+	if len(schema.Enum) > 0 && !contains(schema.Enum, node.Value) {
+		errs.add(l.errorf(node, nil, "invalid value '%s', expect one of %s", node.Value, strings.Join(schema.Enum, ", ")))
+		return
+	}
+	if schema.Pattern != "" && !patternRegexp(schema.Pattern).MatchString(node.Value) {
+		errs.add(l.errorf(node, nil, "invalid value '%s', expect to match %s", node.Value, schema.Pattern))
+	}
+}
+
+var (
+	patterns   = make(map[string]*regexp.Regexp)
+	patternsMu sync.Mutex
+)
+
+func patternRegexp(pattern string) *regexp.Regexp {
+	patternsMu.Lock()
+	defer patternsMu.Unlock()
+	re, ok := patterns[pattern]
+	if !ok {
+		re = regexp.MustCompile(pattern)
+		patterns[pattern] = re
+	}
+	return re
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// errorf returns the error at the position of node, the position of key is used if node is
+// merged from several files
+func (l *loader) errorf(node, key *yaml.Node, format string, args ...interface{}) error {
+	file, ok := l.files[node]
+	if !ok && key != nil {
+		node = key
+		file = l.files[key]
+	}
+	return &FieldError{File: file, Line: node.Line, Column: node.Column, Msg: fmt.Sprintf(format, args...)}
+}
+
+// suggest returns a hint of the known field which is similar to name
+func suggest(name string, fields map[string]*Schema) string {
+	best, bestDistance := "", 3
+	for _, field := range utils.SortedKeys(fields) {
+		if d := distance(strings.ToLower(name), strings.ToLower(field)); d < bestDistance {
+			best, bestDistance = field, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean '%s'?", best)
+}
+
+// distance is the levenshtein distance between a and b
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
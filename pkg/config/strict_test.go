@@ -0,0 +1,149 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestCheckFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{
+			name: "valid",
+			config: `
+settings:
+  rootPath: /opt
+  firewall:
+    mode: manage
+nodes:
+  node1:
+    address: 10.0.0.1
+    sshPort: 22
+    requirement:
+      kernelVersion: 5.4
+      memory: 4Gi
+`,
+		},
+		{
+			name:   "null is ignored",
+			config: "settings:\n  ssh: ~\nnodes:\n",
+		},
+		{
+			name:   "unknown field with suggestion",
+			config: "nodes:\n  node1:\n    sshPrt: 22",
+			want:   []string{"c.yaml:3:5: unknown field 'sshPrt', did you mean 'sshPort'?"},
+		},
+		{
+			name:   "unknown field without suggestion",
+			config: "settings:\n  something: 1",
+			want:   []string{"c.yaml:2:3: unknown field 'something'"},
+		},
+		{
+			name:   "wrong type",
+			config: "nodes:\n  node1:\n    sshPort: abc",
+			want:   []string{"c.yaml:3:14: invalid value 'abc', expect type integer"},
+		},
+		{
+			name:   "out of enum",
+			config: "settings:\n  firewall:\n    mode: off",
+			want:   []string{"c.yaml:3:11: invalid value 'off', expect one of manage, disable, skip"},
+		},
+		{
+			name:   "not match pattern",
+			config: "nodes:\n  node1:\n    requirement:\n      memory: lots",
+			want:   []string{"c.yaml:4:15: invalid value 'lots', expect to match " + capacityPattern},
+		},
+		{
+			name:   "expect mapping",
+			config: "settings: [a]",
+			want:   []string{"c.yaml:1:11: expect a mapping"},
+		},
+		{
+			name:   "expect list",
+			config: "settings:\n  cluster:\n    master: node1",
+			want:   []string{"c.yaml:3:13: expect a list"},
+		},
+		{
+			name:   "all errors reported",
+			config: "settings:\n  rootPth: /opt\n  haIP: [a]\nnodes:\n  node1:\n    sshPort: abc",
+			want: []string{
+				"c.yaml:2:3: unknown field 'rootPth', did you mean 'rootPath'?",
+				"c.yaml:3:9: expect type string",
+				"c.yaml:6:14: invalid value 'abc', expect type integer",
+			},
+		},
+	}
+	for _, tt := range tests {
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(tt.config), &doc); err != nil {
+			t.Fatal(err)
+		}
+		l := &loader{}
+		l.record(&doc, "c.yaml")
+		err := l.checkFields(doc.Content[0])
+		if len(tt.want) == 0 {
+			if err != nil {
+				t.Errorf("%s: checkFields() error = %v", tt.name, err)
+			}
+			continue
+		}
+		var errs Errors
+		if !errors.As(err, &errs) {
+			t.Errorf("%s: checkFields() error = %v, want %v", tt.name, err, tt.want)
+			continue
+		}
+		if len(errs) != len(tt.want) {
+			t.Errorf("%s: checkFields() error = %v, want %v", tt.name, err, tt.want)
+			continue
+		}
+		for i, e := range errs {
+			if e.Error() != tt.want[i] {
+				t.Errorf("%s: checkFields() error %d = %s, want %s", tt.name, i, e, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	fields := map[string]*Schema{"address": {}, "sshPort": {}, "user": {}, "useAgent": {}}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "adress", want: ", did you mean 'address'?"},
+		{name: "SSHPORT", want: ", did you mean 'sshPort'?"},
+		{name: "usr", want: ", did you mean 'user'?"},
+		{name: "useagnt", want: ", did you mean 'useAgent'?"},
+		{name: "hostname", want: ""},
+	}
+	for _, tt := range tests {
+		if got := suggest(tt.name, fields); got != tt.want {
+			t.Errorf("suggest(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	var errs Errors
+	if errs.err() != nil {
+		t.Errorf("err() of no error is not nil")
+	}
+	errs.add(nil)
+	errs.add(&FieldError{File: "a.yaml", Line: 1, Column: 2, Msg: "first"})
+	errs.add(Errors{
+		&FieldError{Line: 3, Column: 4, Msg: "second"},
+		errors.New("third"),
+	})
+	if len(errs) != 3 {
+		t.Fatalf("add() gives %d errors, want 3", len(errs))
+	}
+	want := "a.yaml:1:2: first\nline 3, column 4: second\nthird"
+	if err := errs.err(); err == nil || err.Error() != want {
+		t.Errorf("err() = %v, want %s", err, want)
+	}
+}
@@ -1,192 +1,589 @@
 package config
 
 import (
-	"encoding/base64"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/godzilla-s/k3s-installer/pkg/utils"
 )
 
+// validate fills the defaults and validates config, all the errors are collected and returned together
 func (c *Config) validate() error {
-	if err := c.validateSettings(); err != nil {
-		return err
-	}
-	if err := c.validateCharts(); err != nil {
-		return err
-	}
-	if err := c.validateNodes(); err != nil {
-		return err
-	}
-	if err := c.validatePackages(); err != nil {
-		return err
-	}
-	if err := c.validateImages(); err != nil {
-		return err
-	}
-	if err := c.validateSteps(); err != nil {
-		return err
-	}
-	return nil
+	var errs Errors
+	errs.add(c.validateSettings())
+	errs.add(c.validateCharts())
+	errs.add(c.validateNodes())
+	errs.add(c.validatePackages())
+	errs.add(c.validateImages())
+	errs.add(c.validateSteps())
+	return errs.err()
 }
 
 func (c *Config) validateSettings() error {
+	var errs Errors
 	if c.Settings.HaIP == "" {
-		return fmt.Errorf("invalid settings: missing ha IP address")
+		errs.add(fmt.Errorf("invalid settings: missing ha IP address"))
 	}
 	if c.Settings.RootPath == "" {
 		c.Settings.RootPath = "./"
 	}
+	if rootPath, err := filepath.Abs(c.Settings.RootPath); err == nil {
+		c.Settings.RootPath = rootPath
+	}
+	if len(c.Settings.SSH.KnownHosts) == 0 {
+		c.Settings.SSH.KnownHosts = []string{DefaultKnownHosts}
+	}
+	switch c.Settings.SSH.HostKeyPolicy {
+	case "":
+		c.Settings.SSH.HostKeyPolicy = HostKeyPolicyTOFU
+	case HostKeyPolicyStrict, HostKeyPolicyTOFU:
+	default:
+		errs.add(fmt.Errorf("invalid settings: unknown host key policy '%s'", c.Settings.SSH.HostKeyPolicy))
+	}
+	token, err := c.resolveSecret(c.Settings.Token)
+	if err != nil {
+		errs.add(fmt.Errorf("invalid settings: invalid token: %v", err))
+	}
+	c.Settings.Token = token
+	agentToken, err := c.resolveSecret(c.Settings.AgentToken)
+	if err != nil {
+		errs.add(fmt.Errorf("invalid settings: invalid agent token: %v", err))
+	}
+	c.Settings.AgentToken = agentToken
+	if c.Settings.Hosts.HaHostname == "" {
+		c.Settings.Hosts.HaHostname = DefaultHaHostname
+	}
+	switch c.Settings.Firewall.Mode {
+	case "":
+		c.Settings.Firewall.Mode = FirewallManage
+	case FirewallManage, FirewallDisable, FirewallSkip:
+	default:
+		errs.add(fmt.Errorf("invalid settings: unknown firewall mode '%s'", c.Settings.Firewall.Mode))
+	}
+	registries := make(map[string]bool)
+	// mirroring maps the upstream to the first registry mirroring it
+	mirroring := make(map[string]*Registry)
+	for i, registry := range c.Settings.Registries {
+		if err := c.validateRegistry(registry); err != nil {
+			errs.add(fmt.Errorf("invalid settings: registry %d: %v", i, err))
+		}
+		if registries[registry.Address] {
+			errs.add(fmt.Errorf("invalid settings: registry %s is duplicated", registry.Address))
+		}
+		registries[registry.Address] = true
+		// the rewrites belong to the upstream in registries.yaml, they are shared by its mirrors
+		for _, upstream := range registry.Mirrors {
+			first, ok := mirroring[upstream]
+			if !ok {
+				mirroring[upstream] = registry
+				continue
+			}
+			if !equalRewrites(first.Rewrites, registry.Rewrites) {
+				errs.add(fmt.Errorf("invalid settings: registries %s and %s mirror %s with different rewrites",
+					first.Address, registry.Address, upstream))
+			}
+		}
+	}
+	for i, bastion := range c.Settings.Bastion {
+		if err := c.validateBastion(bastion); err != nil {
+			errs.add(fmt.Errorf("invalid settings: bastion %d: %v", i, err))
+		}
+	}
 	for _, name := range c.Settings.Cluster.Master {
 		if _, ok := c.Nodes[name]; !ok {
-			return fmt.Errorf("invalid settings: missing master node <%s> defined", name)
+			errs.add(fmt.Errorf("invalid settings: missing master node <%s> defined", name))
 		}
 	}
 	for _, name := range c.Settings.Cluster.Worker {
 		if _, ok := c.Nodes[name]; !ok {
-			return fmt.Errorf("invalid settings: missing worker node <%s> defined", name)
+			errs.add(fmt.Errorf("invalid settings: missing worker node <%s> defined", name))
 		}
 	}
 
-	return nil
+	return errs.err()
 }
+
 func (c *Config) validateCharts() error {
+	var errs Errors
+	for _, name := range utils.SortedKeys(c.Charts) {
+		errs.add(c.validateChart(name, c.Charts[name]))
+	}
+	return errs.err()
+}
 
-	for name, chart := range c.Charts {
-		if chart.Namespace == "" {
-			chart.Namespace = "default"
-		}
-		if chart.Version == "" {
-			return fmt.Errorf("invalid chart <%s>: missing version", name)
-		}
-		if chart.Path == "" {
-			chart.Path = filepath.Join("charts", name)
-		}
+func (c *Config) validateChart(name string, chart *Chart) error {
+	if chart.Namespace == "" {
+		chart.Namespace = "default"
+	}
+	if chart.Version == "" {
+		return fmt.Errorf("invalid chart <%s>: missing version", name)
+	}
+	if chart.Path == "" {
+		chart.Path = filepath.Join("charts", name)
+	}
 
-		chartPkg := filepath.Join(c.Settings.RootPath, chart.Path, fmt.Sprintf("%s-%s.tgz", name, chart.Version))
-		fi, err := os.Stat(chartPkg)
-		if err != nil {
+	chartPkg := filepath.Join(c.Settings.RootPath, chart.Path, fmt.Sprintf("%s-%s.tgz", name, chart.Version))
+	fi, err := os.Stat(chartPkg)
+	if chart.Repo != "" {
+		// the chart is pulled from repo if it is not cached
+		if err := c.validateChartRepo(chart, name); err != nil {
 			return fmt.Errorf("invalid chart <%s>: %v", name, err)
 		}
-		if fi.IsDir() {
-			return fmt.Errorf("invalid chart <%s>: chart package not exist", name)
+	} else if err != nil {
+		return fmt.Errorf("invalid chart <%s>: %v", name, err)
+	}
+	if err == nil && fi.IsDir() {
+		return fmt.Errorf("invalid chart <%s>: chart package not exist", name)
+	}
+	chart.Path = chartPkg
+	if chart.ReleaseName == "" {
+		chart.ReleaseName = name
+	}
+	// values.yaml next to the chart package is used as the first values file if it exists
+	defaultValues := filepath.Join(filepath.Dir(chartPkg), "values.yaml")
+	if _, err = os.Stat(defaultValues); err == nil {
+		chart.ValuesFiles = append([]string{defaultValues}, chart.ValuesFiles...)
+	}
+	for i, file := range chart.ValuesFiles {
+		if file == defaultValues {
+			continue
 		}
-		chart.Path = chartPkg
-		if chart.ReleaseName == "" {
-			chart.ReleaseName = name
+		chart.ValuesFiles[i] = c.resolvePath(file)
+		if _, err = os.Stat(chart.ValuesFiles[i]); err != nil {
+			return fmt.Errorf("invalid chart <%s>: values file %v", name, err)
 		}
 	}
+	for i, setFile := range chart.SetFile {
+		var pairs []string
+		for _, pair := range strings.Split(setFile, ",") {
+			key, file, ok := strings.Cut(pair, "=")
+			if !ok || key == "" || file == "" {
+				return fmt.Errorf("invalid chart <%s>: invalid setFile '%s', expect key=path", name, setFile)
+			}
+			file = c.resolvePath(file)
+			if _, err = os.Stat(file); err != nil {
+				return fmt.Errorf("invalid chart <%s>: setFile %v", name, err)
+			}
+			pairs = append(pairs, key+"="+file)
+		}
+		chart.SetFile[i] = strings.Join(pairs, ",")
+	}
+	return nil
+}
 
+func (c *Config) validateChartRepo(chart *Chart, name string) error {
+	u, err := url.Parse(chart.Repo)
+	if err != nil {
+		return fmt.Errorf("invalid repo: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "oci":
+	default:
+		return fmt.Errorf("invalid repo '%s': scheme must be http, https or oci", chart.Repo)
+	}
+	if chart.Chart == "" {
+		chart.Chart = name
+	}
+	if chart.Username, err = c.resolveSecret(chart.Username); err != nil {
+		return fmt.Errorf("invalid username: %v", err)
+	}
+	if chart.Password != "" {
+		if chart.Password, err = c.decodePassword(chart.Password); err != nil {
+			return fmt.Errorf("invalid password: %v", err)
+		}
+	}
+	if chart.CaFile != "" {
+		chart.CaFile = c.resolvePath(chart.CaFile)
+		if _, err = os.Stat(chart.CaFile); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func (c *Config) validatePackages() error {
-	for name, pkg := range c.Packages {
-		switch pkg.Type {
-		case PackageFile:
-			if pkg.Path == "" {
-				return fmt.Errorf("invalid package <%s>: missing path", name)
-			}
-			pkg.Path = filepath.Join(c.Settings.RootPath, pkg.Path)
-			fi, err := os.Stat(pkg.Path)
-			if err != nil {
-				return fmt.Errorf("invalid package <%s>: %v", name, err)
-			}
-			if fi.IsDir() {
-				return fmt.Errorf("invalid package <%s>: not a exectable file", name)
-			}
-		case PackageDirectory:
-			if pkg.Path == "" {
-				return fmt.Errorf("invalid package <%s>: missing path", name)
-			}
-			if pkg.TargetPath == "" {
-				return fmt.Errorf("invalid package <%s>: missing target path", name)
-			}
-			pkg.Path = filepath.Join(c.Settings.RootPath, pkg.Path)
-			fi, err := os.Stat(pkg.Path)
-			if err != nil {
-				return err
-			}
+	var errs Errors
+	for _, name := range utils.SortedKeys(c.Packages) {
+		errs.add(c.validatePackage(name, c.Packages[name]))
+	}
+	return errs.err()
+}
 
-			if !fi.IsDir() {
-				return fmt.Errorf("invalid package <%s>: not a directory", name)
-			}
-		case PackageRPM:
-			if pkg.Path == "" {
-				return fmt.Errorf("invalid package <%s>: missing path", name)
-			}
-			pkg.Path = filepath.Join(c.Settings.RootPath, pkg.Path)
-		case PackageDockerService:
-			if pkg.Path == "" {
-				return fmt.Errorf("invalid package <%s>: missing path", name)
-			}
-			pkg.Path = filepath.Join(c.Settings.RootPath, pkg.Path)
-		default:
-			return fmt.Errorf("invalid package <%s>: unknown type '%s'", name, pkg.Type)
+func (c *Config) validatePackage(name string, pkg *Package) error {
+	switch pkg.Type {
+	case PackageFile:
+		if pkg.Path == "" {
+			return fmt.Errorf("invalid package <%s>: missing path", name)
+		}
+		pkg.Path = filepath.Join(c.Settings.RootPath, pkg.Path)
+		fi, err := os.Stat(pkg.Path)
+		if err != nil {
+			return fmt.Errorf("invalid package <%s>: %v", name, err)
+		}
+		if fi.IsDir() {
+			return fmt.Errorf("invalid package <%s>: not a exectable file", name)
 		}
+	case PackageDirectory:
+		if pkg.Path == "" {
+			return fmt.Errorf("invalid package <%s>: missing path", name)
+		}
+		if pkg.TargetPath == "" {
+			return fmt.Errorf("invalid package <%s>: missing target path", name)
+		}
+		pkg.Path = filepath.Join(c.Settings.RootPath, pkg.Path)
+		fi, err := os.Stat(pkg.Path)
+		if err != nil {
+			return err
+		}
+
+		if !fi.IsDir() {
+			return fmt.Errorf("invalid package <%s>: not a directory", name)
+		}
+	case PackageRPM, PackageDeb:
+		if pkg.Path == "" {
+			return fmt.Errorf("invalid package <%s>: missing path", name)
+		}
+		pkg.Path = filepath.Join(c.Settings.RootPath, pkg.Path)
+	case PackageDockerService:
+		if pkg.Path == "" {
+			return fmt.Errorf("invalid package <%s>: missing path", name)
+		}
+		pkg.Path = filepath.Join(c.Settings.RootPath, pkg.Path)
+	default:
+		return fmt.Errorf("invalid package <%s>: unknown type '%s'", name, pkg.Type)
 	}
 	return nil
 }
 
+// resolvePath returns the file relative to root path unless it is absolute
+func (c *Config) resolvePath(file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(c.Settings.RootPath, file)
+}
+
+// hostnameRegexp matches the lowercase RFC 1123 names which kubernetes accepts as node name
+var hostnameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
 func (c *Config) validateNodes() error {
-	for name, node := range c.Nodes {
-		if node.Address == "" {
-			return fmt.Errorf("invalid node <%s>: missing host", name)
+	hostnames := make(map[string]string)
+	masters := make(map[string]bool)
+	for _, name := range c.Settings.Cluster.Master {
+		masters[name] = true
+	}
+	var errs Errors
+	for _, name := range utils.SortedKeys(c.Nodes) {
+		errs.add(c.validateNode(name, c.Nodes[name], masters[name], hostnames))
+	}
+	return errs.err()
+}
+
+// sysctlKeyRegexp matches the sysctl like net.ipv4.ip_forward, the dots in interface name are slashes
+var sysctlKeyRegexp = regexp.MustCompile(`^[a-z0-9_./-]+$`)
+
+// validateNode validates the node, hostnames records the hostname of validated nodes to find duplicates
+func (c *Config) validateNode(name string, node *Node, isMaster bool, hostnames map[string]string) error {
+	if node.Address == "" {
+		return fmt.Errorf("invalid node <%s>: missing host", name)
+	}
+	if node.PrivateKey == "" {
+		node.PrivateKey = c.Settings.SSH.PrivateKey
+		if node.Passphrase == "" {
+			node.Passphrase = c.Settings.SSH.Passphrase
 		}
-		if node.RootPassword == "" {
-			return fmt.Errorf("invalid node <%s>: missing root password", name)
+	}
+	if node.PrivateKey != "" && !filepath.IsAbs(node.PrivateKey) && !strings.HasPrefix(node.PrivateKey, "~/") {
+		node.PrivateKey = filepath.Join(c.Settings.RootPath, node.PrivateKey)
+	}
+	if node.UseAgent == nil {
+		useAgent := c.Settings.SSH.UseAgent
+		node.UseAgent = &useAgent
+	}
+	if node.RootPassword == "" && node.PrivateKey == "" && !*node.UseAgent {
+		return fmt.Errorf("invalid node <%s>: missing ssh auth, one of privateKey, useAgent or rootPassword is required", name)
+	}
+	if node.RootPassword != "" {
+		decPwd, err := c.decodePassword(node.RootPassword)
+		if err != nil {
+			return fmt.Errorf("invalid node <%s>: invalid password: %v", name, err)
 		}
-		decPwd, err := base64.StdEncoding.DecodeString(node.RootPassword)
+		node.RootPassword = decPwd
+	}
+	passphrase, err := c.resolveSecret(node.Passphrase)
+	if err != nil {
+		return fmt.Errorf("invalid node <%s>: invalid passphrase: %v", name, err)
+	}
+	node.Passphrase = passphrase
+	if node.User == "" {
+		node.User = c.Settings.SSH.User
+	}
+	if node.User == "" {
+		node.User = "root"
+	}
+	if node.Become == nil {
+		become := c.Settings.SSH.Become
+		node.Become = &become
+	}
+	if node.User != "root" && !*node.Become {
+		return fmt.Errorf("invalid node <%s>: user %s requires become to install k3s", name, node.User)
+	}
+	if node.BecomePassword == "" {
+		node.BecomePassword = c.Settings.SSH.BecomePassword
+	}
+	if node.BecomePassword != "" {
+		decPwd, err := c.decodePassword(node.BecomePassword)
 		if err != nil {
-			return fmt.Errorf("invalid node <%s>: invalid password", name)
+			return fmt.Errorf("invalid node <%s>: invalid become password: %v", name, err)
 		}
-		node.RootPassword = string(decPwd)
-		if node.OS == "" {
-			node.OS = "centos"
+		node.BecomePassword = decPwd
+	} else if *node.Become {
+		// sudo usually asks the password of login user
+		node.BecomePassword = node.RootPassword
+	}
+	if node.SSHPort == 0 {
+		node.SSHPort = 22
+	}
+	if node.Bastion == nil {
+		node.Bastion = c.Settings.Bastion
+	} else {
+		for i, bastion := range node.Bastion {
+			if err := c.validateBastion(bastion); err != nil {
+				return fmt.Errorf("invalid node <%s>: bastion %d: %v", name, i, err)
+			}
 		}
-
-		if node.SSHPort == 0 {
-			node.SSHPort = 22
+	}
+	if node.Hostname != "" {
+		if !hostnameRegexp.MatchString(node.Hostname) {
+			return fmt.Errorf("invalid node <%s>: invalid hostname '%s'", name, node.Hostname)
 		}
-		for _, pkgName := range node.InstallPackages {
-			if _, ok := c.Packages[pkgName]; !ok {
-				return fmt.Errorf("invalid node <%s>: missing package %s", name, pkgName)
-			}
+		if other, ok := hostnames[node.Hostname]; ok {
+			return fmt.Errorf("invalid node <%s>: hostname '%s' is duplicated with node <%s>", name, node.Hostname, other)
 		}
-		for _, imageName := range node.PreloadImages {
-			if _, ok := c.Images[imageName]; !ok {
-				return fmt.Errorf("invalid node <%s>: missing image %s", name, imageName)
-			}
+		hostnames[node.Hostname] = name
+	}
+	if err := node.Requirement.validate(); err != nil {
+		return fmt.Errorf("invalid node <%s>: %v", name, err)
+	}
+	// the sysctls are written into a sysctl.d file and passed to sysctl command
+	for _, key := range utils.SortedKeys(node.Sysctls) {
+		if !sysctlKeyRegexp.MatchString(key) {
+			return fmt.Errorf("invalid node <%s>: invalid sysctl '%s'", name, key)
+		}
+		if strings.ContainsAny(node.Sysctls[key], "\r\n") {
+			return fmt.Errorf("invalid node <%s>: invalid value of sysctl %s, it must be a single line", name, key)
+		}
+	}
+	if err := node.K3S.validate(isMaster); err != nil {
+		return fmt.Errorf("invalid node <%s>: %v", name, err)
+	}
+	for _, pkgName := range node.InstallPackages {
+		if _, ok := c.Packages[pkgName]; !ok {
+			return fmt.Errorf("invalid node <%s>: missing package %s", name, pkgName)
+		}
+	}
+	for _, imageName := range node.PreloadImages {
+		if _, ok := c.Images[imageName]; !ok {
+			return fmt.Errorf("invalid node <%s>: missing image %s", name, imageName)
 		}
 	}
 	return nil
 }
 
-func (c *Config) validateImages() error {
-	for name, img := range c.Images {
-		imagePath := filepath.Join(c.Settings.RootPath, img.Path)
-		fi, err := os.Stat(imagePath)
+func (c *Config) validateBastion(bastion *Bastion) error {
+	if bastion.Address == "" {
+		return fmt.Errorf("missing address")
+	}
+	if bastion.SSHPort == 0 {
+		bastion.SSHPort = 22
+	}
+	if bastion.User == "" {
+		bastion.User = c.Settings.SSH.User
+	}
+	if bastion.User == "" {
+		bastion.User = "root"
+	}
+	if bastion.PrivateKey == "" {
+		bastion.PrivateKey = c.Settings.SSH.PrivateKey
+		if bastion.Passphrase == "" {
+			bastion.Passphrase = c.Settings.SSH.Passphrase
+		}
+	}
+	if bastion.PrivateKey != "" && !filepath.IsAbs(bastion.PrivateKey) && !strings.HasPrefix(bastion.PrivateKey, "~/") {
+		bastion.PrivateKey = filepath.Join(c.Settings.RootPath, bastion.PrivateKey)
+	}
+	if bastion.UseAgent == nil {
+		useAgent := c.Settings.SSH.UseAgent
+		bastion.UseAgent = &useAgent
+	}
+	if bastion.Password != "" {
+		decPwd, err := c.decodePassword(bastion.Password)
+		if err != nil {
+			return fmt.Errorf("invalid password: %v", err)
+		}
+		bastion.Password = decPwd
+	}
+	passphrase, err := c.resolveSecret(bastion.Passphrase)
+	if err != nil {
+		return fmt.Errorf("invalid passphrase: %v", err)
+	}
+	bastion.Passphrase = passphrase
+	if bastion.Password == "" && bastion.PrivateKey == "" && !*bastion.UseAgent {
+		return fmt.Errorf("missing ssh auth, one of privateKey, useAgent or password is required")
+	}
+	return nil
+}
+
+func (c *Config) validateRegistry(registry *Registry) error {
+	if registry.Address == "" {
+		return fmt.Errorf("missing address")
+	}
+	username, err := c.resolveSecret(registry.Username)
+	if err != nil {
+		return fmt.Errorf("invalid username: %v", err)
+	}
+	registry.Username = username
+	if registry.Password != "" {
+		decPwd, err := c.decodePassword(registry.Password)
 		if err != nil {
-			return fmt.Errorf("invalid image <%s>: %v", name, err)
+			return fmt.Errorf("invalid password: %v", err)
+		}
+		registry.Password = decPwd
+	}
+	if (registry.Cert == "") != (registry.Key == "") {
+		return fmt.Errorf("cert and key must be given together")
+	}
+	for _, file := range []*string{&registry.CaCert, &registry.Cert, &registry.Key} {
+		if *file == "" {
+			continue
+		}
+		*file = c.resolvePath(*file)
+		fi, err := os.Stat(*file)
+		if err != nil {
+			return err
 		}
 		if fi.IsDir() {
-			return fmt.Errorf("invalid image <%s>: image is directory", name)
+			return fmt.Errorf("%s is a directory", *file)
+		}
+	}
+	for expr := range registry.Rewrites {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("invalid rewrite '%s': %v", expr, err)
+		}
+	}
+	return nil
+}
+
+func equalRewrites(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
 		}
-		img.Path = imagePath
 	}
+	return true
+}
+
+func (r *Requirement) validate() error {
+	if r.CPU < 0 {
+		return fmt.Errorf("invalid cpu requirement %d", r.CPU)
+	}
+	if r.Memory != "" {
+		if _, err := utils.ParseCapacity(r.Memory); err != nil {
+			return fmt.Errorf("invalid memory requirement: %v", err)
+		}
+	}
+	if r.Storage != "" {
+		if _, err := utils.ParseCapacity(r.Storage); err != nil {
+			return fmt.Errorf("invalid storage requirement: %v", err)
+		}
+	}
+	if r.KernelVersion != "" {
+		if _, err := utils.ParseKernelVersion(r.KernelVersion); err != nil {
+			return fmt.Errorf("invalid kernel version requirement: %v", err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateImages() error {
+	var errs Errors
+	for _, name := range utils.SortedKeys(c.Images) {
+		errs.add(c.validateImage(name, c.Images[name]))
+	}
+	return errs.err()
+}
+
+func (c *Config) validateImage(name string, img *Image) error {
+	imagePath := filepath.Join(c.Settings.RootPath, img.Path)
+	fi, err := os.Stat(imagePath)
+	if err != nil {
+		return fmt.Errorf("invalid image <%s>: %v", name, err)
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("invalid image <%s>: image is directory", name)
+	}
+	img.Path = imagePath
 	return nil
 }
 
 func (c *Config) validateSteps() error {
+	var errs Errors
 	for _, step := range c.Steps {
 		switch step.Type {
 		case "k3s":
 		case "chart":
 			for _, chartName := range step.Charts {
 				if _, ok := c.Charts[chartName]; !ok {
-					return fmt.Errorf("invalid step <%s>: missing chart <%s>", step.Type, chartName)
+					errs.add(fmt.Errorf("invalid step <%s>: missing chart <%s>", step.Type, chartName))
 				}
 			}
 		}
 	}
+	return errs.err()
+}
+
+// taintRegexp matches the taint like key=value:NoSchedule or key:NoExecute
+var taintRegexp = regexp.MustCompile(`^[^=:\s]+(=[^:\s]*)?:(NoSchedule|PreferNoSchedule|NoExecute)$`)
+
+// reservedK3SConfig are managed by installer to create and join the cluster
+var reservedK3SConfig = []string{"cluster-init", "server", "token", "agent-token"}
+
+func (k *NodeK3SConfig) validate(isMaster bool) error {
+	for _, ips := range []string{k.NodeIP, k.NodeExternalIP} {
+		if ips == "" {
+			continue
+		}
+		for _, ip := range strings.Split(ips, ",") {
+			if net.ParseIP(strings.TrimSpace(ip)) == nil {
+				return fmt.Errorf("invalid k3s config: invalid ip '%s'", ip)
+			}
+		}
+	}
+	for _, label := range k.NodeLabels {
+		if key, _, ok := strings.Cut(label, "="); !ok || key == "" {
+			return fmt.Errorf("invalid k3s config: invalid node label '%s', expect key=value", label)
+		}
+	}
+	for _, taint := range k.NodeTaints {
+		if !taintRegexp.MatchString(taint) {
+			return fmt.Errorf("invalid k3s config: invalid node taint '%s', expect key=value:Effect", taint)
+		}
+	}
+	if !isMaster && len(k.KubeApiserverArgs) > 0 {
+		return fmt.Errorf("invalid k3s config: kubeApiserverArgs is only available on master")
+	}
+	for _, key := range reservedK3SConfig {
+		if _, ok := k.ExtraConfig[key]; ok {
+			return fmt.Errorf("invalid k3s config: '%s' in extraConfig is managed by installer", key)
+		}
+	}
 	return nil
 }
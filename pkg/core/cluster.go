@@ -2,6 +2,7 @@ package core
 
 import (
 	"fmt"
+	"path/filepath"
 
 	"github.com/godzilla-s/k3s-installer/pkg/client/kube"
 	"github.com/godzilla-s/k3s-installer/pkg/config"
@@ -19,6 +20,9 @@ type cluster struct {
 	chartClient  *kube.ChartClient
 	log          *logrus.Logger
 	msg          *utils.Print
+	force        bool
+	token        string
+	agentToken   string
 }
 
 type step interface {
@@ -28,9 +32,12 @@ type step interface {
 
 func newCluster(conf *config.Config, log *logrus.Logger) (*cluster, error) {
 	cluster := &cluster{
-		log:       log,
-		msg:       utils.NewMessage(),
-		clusterIP: conf.Settings.HaIP,
+		log:        log,
+		msg:        utils.NewMessage(),
+		clusterIP:  conf.Settings.HaIP,
+		force:      conf.Settings.Force,
+		token:      conf.Settings.Token,
+		agentToken: conf.Settings.AgentToken,
 	}
 
 	for _, master := range conf.Settings.Cluster.Master {
@@ -38,6 +45,7 @@ func newCluster(conf *config.Config, log *logrus.Logger) (*cluster, error) {
 		masterNode, err := node.New(conf.Nodes[master], conf, true, isClusterInit, log)
 		if err != nil {
 			log.Errorf("fail to init node <%s>, error: %v", conf.Nodes[master].Address, err)
+			cluster.close()
 			return nil, err
 		}
 		if isClusterInit {
@@ -50,11 +58,14 @@ func newCluster(conf *config.Config, log *logrus.Logger) (*cluster, error) {
 		workerNode, err := node.New(conf.Nodes[worker], conf, false, false, log)
 		if err != nil {
 			log.Errorf("fail to init node <%s>, error: %v", conf.Nodes[worker].Address, err)
+			cluster.close()
 			return nil, err
 		}
 		cluster.clusterNodes = append(cluster.clusterNodes, workerNode)
 	}
 
+	cluster.setClusterHosts(conf.Settings.Hosts.HaHostname)
+
 	for _, s := range conf.Steps {
 		switch s.Type {
 		case "k3s":
@@ -65,12 +76,34 @@ func newCluster(conf *config.Config, log *logrus.Logger) (*cluster, error) {
 				chart := kube.ToChart(conf.Charts[cname])
 				charts = append(charts, chart)
 			}
-			cluster.steps = append(cluster.steps, &chartStep{cluster: cluster, charts: charts, msg: cluster.msg})
+			helmDir := filepath.Join(conf.Settings.RootPath, config.WorkspaceDir, "helm")
+			cluster.steps = append(cluster.steps, &chartStep{cluster: cluster, charts: charts, msg: cluster.msg, helmDir: helmDir})
 		}
 	}
 	return cluster, nil
 }
 
+// setClusterHosts sets the entries of /etc/hosts on all nodes, they are written only if hosts is managed
+func (c *cluster) setClusterHosts(haHostname string) {
+	var entries []node.HostEntry
+	for _, n := range c.clusterNodes {
+		entries = append(entries, node.HostEntry{Address: n.Name(), Hostnames: []string{n.Hostname()}})
+	}
+	entries = append(entries, node.HostEntry{Address: c.clusterIP, Hostnames: []string{haHostname}})
+	for _, n := range c.clusterNodes {
+		n.SetClusterHosts(entries)
+	}
+}
+
+// close closes the connections of all cluster nodes
+func (c *cluster) close() {
+	for _, n := range c.clusterNodes {
+		if err := n.Close(); err != nil {
+			c.log.Warnf("fail to close connection of node <%s>, error: %v", n.Name(), err)
+		}
+	}
+}
+
 func (c *cluster) installChart(chart *kube.Chart) error {
 	c.initNode.Test()
 	if c.chartClient == nil {
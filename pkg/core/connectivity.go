@@ -0,0 +1,186 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/godzilla-s/k3s-installer/pkg/client/remote"
+	"github.com/godzilla-s/k3s-installer/pkg/config"
+	"github.com/godzilla-s/k3s-installer/pkg/node"
+	"github.com/sirupsen/logrus"
+)
+
+// CheckConnectivity prints the reachability matrix of the ports required by k3s between nodes
+func CheckConnectivity(conf *config.Config, log *logrus.Logger) error {
+	cluster, err := newCluster(conf, log)
+	if err != nil {
+		return err
+	}
+	defer cluster.close()
+	return cluster.checkConnectivity()
+}
+
+type probeKey struct {
+	src  *node.Node
+	dst  *node.Node
+	port remote.Port
+}
+
+// checkConnectivity starts listeners on every node and probes them from every other node
+func (c *cluster) checkConnectivity() error {
+	c.msg.Message("check connectivity between nodes")
+	if len(c.clusterNodes) < 2 {
+		return nil
+	}
+
+	maxTargets := 0
+	for _, src := range c.clusterNodes {
+		targets := 0
+		for _, dst := range c.clusterNodes {
+			if dst != src {
+				targets += len(dst.InboundPorts(src))
+			}
+		}
+		if targets > maxTargets {
+			maxTargets = targets
+		}
+	}
+	// every tcp probe takes 3 seconds at most
+	duration := 10*time.Second + time.Duration(maxTargets)*3*time.Second
+
+	// the file where the listeners of node record the probes
+	recordFiles := make(map[*node.Node]string)
+	for _, n := range c.clusterNodes {
+		file, err := n.StartProbeListeners(duration)
+		if err != nil {
+			c.log.Warnf("fail to start probe listeners on node <%s>, udp ports cannot be checked, error: %v", n.Name(), err)
+			continue
+		}
+		recordFiles[n] = file
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mux     sync.Mutex
+		results = make(map[probeKey]error)
+	)
+	for _, src := range c.clusterNodes {
+		wg.Add(1)
+		go func(src *node.Node) {
+			defer wg.Done()
+			var targets []remote.ProbeTarget
+			owners := make(map[remote.ProbeTarget]*node.Node)
+			for _, dst := range c.clusterNodes {
+				if dst == src {
+					continue
+				}
+				for _, port := range dst.InboundPorts(src) {
+					target := remote.ProbeTarget{Host: dst.Name(), Port: port}
+					targets = append(targets, target)
+					owners[target] = dst
+				}
+			}
+			probed, err := src.Probe(targets)
+			mux.Lock()
+			defer mux.Unlock()
+			for _, target := range targets {
+				key := probeKey{src: src, dst: owners[target], port: target.Port}
+				if err != nil {
+					results[key] = err
+					continue
+				}
+				results[key] = probed[target]
+			}
+		}(src)
+	}
+	wg.Wait()
+
+	// give the listeners time to receive the udp probes
+	time.Sleep(time.Second)
+	records := make(map[*node.Node]*remote.ListenerRecord)
+	for _, n := range c.clusterNodes {
+		file, ok := recordFiles[n]
+		if !ok {
+			continue
+		}
+		record, err := n.ReadProbeRecord(file)
+		if err != nil {
+			c.log.Warnf("fail to read probe record on node <%s>, error: %v", n.Name(), err)
+			continue
+		}
+		records[n] = record
+	}
+
+	return c.printConnectivity(results, records)
+}
+
+func (c *cluster) printConnectivity(results map[probeKey]error, records map[*node.Node]*remote.ListenerRecord) error {
+	var ports []remote.Port
+	seen := make(map[remote.Port]bool)
+	for _, dst := range c.clusterNodes {
+		for _, src := range c.clusterNodes {
+			for _, port := range dst.InboundPorts(src) {
+				if !seen[port] {
+					seen[port] = true
+					ports = append(ports, port)
+				}
+			}
+		}
+	}
+
+	failed := 0
+	for _, port := range ports {
+		headers := []string{port.String()}
+		for _, dst := range c.clusterNodes {
+			headers = append(headers, dst.Name())
+		}
+		var rows [][]string
+		for _, src := range c.clusterNodes {
+			row := []string{src.Name()}
+			for _, dst := range c.clusterNodes {
+				err, ok := results[probeKey{src: src, dst: dst, port: port}]
+				cell := "-"
+				if ok {
+					cell = probeStatus(port, src, err, records[dst])
+					if cell == "FAIL" {
+						failed++
+						c.log.Debugf("%s -> %s %s unreachable: %v", src.Name(), dst.Name(), port, err)
+					}
+				}
+				row = append(row, cell)
+			}
+			rows = append(rows, row)
+		}
+		c.msg.Table(headers, rows)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d port(s) unreachable between nodes", failed)
+	}
+	return nil
+}
+
+// probeStatus returns the cell of matrix, udp is checked by whether the listener has received the probe
+func probeStatus(port remote.Port, src *node.Node, err error, record *remote.ListenerRecord) string {
+	if port.Protocol == "tcp" {
+		if err != nil {
+			return "FAIL"
+		}
+		return "ok"
+	}
+	if err != nil && err != remote.ErrNoPython {
+		return "FAIL"
+	}
+	if record == nil || err == remote.ErrNoPython {
+		return "unknown"
+	}
+	if record.Busy[port.String()] {
+		return "in use"
+	}
+	for _, token := range record.Received[port.String()] {
+		if token == src.Name() {
+			return "ok"
+		}
+	}
+	return "FAIL"
+}
@@ -16,6 +16,12 @@ func Install(conf *config.Config, log *logrus.Logger) error {
 	if err != nil {
 		return err
 	}
+	defer cluster.close()
+
+	err = cluster.preflight()
+	if err != nil {
+		return err
+	}
 
 	for _, s := range cluster.steps {
 		err := s.install()
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/godzilla-s/k3s-installer/pkg/node"
+)
+
+// preflight checks all nodes before anything is uploaded, it fails with a table of
+// the failed checks of every node
+func (c *cluster) preflight() error {
+	c.msg.Step("preflight")
+	failures := make(map[*node.Node][]node.CheckFailure)
+	for _, n := range c.clusterNodes {
+		failures[n] = n.CheckRequirement()
+	}
+	// k3s rejects nodes with the same name, cloned vms usually have the same hostname
+	hostnames := make(map[string][]*node.Node)
+	for _, n := range c.clusterNodes {
+		hostnames[n.Hostname()] = append(hostnames[n.Hostname()], n)
+	}
+	for _, n := range c.clusterNodes {
+		var others []string
+		for _, other := range hostnames[n.Hostname()] {
+			if other != n {
+				others = append(others, other.Name())
+			}
+		}
+		if len(others) > 0 {
+			failures[n] = append(failures[n], node.CheckFailure{
+				Check:    "hostname",
+				Expected: "unique",
+				Actual:   fmt.Sprintf("%s, same as %s", n.Hostname(), strings.Join(others, ", ")),
+			})
+		}
+	}
+	if err := c.reportFailures(failures); err != nil {
+		return err
+	}
+	c.msg.Message("all nodes passed preflight checks")
+	return nil
+}
+
+// checkConflicts finds the ports and processes on nodes which conflict with k3s,
+// installing continues with a warning if it is forced
+func (c *cluster) checkConflicts() error {
+	c.msg.Message("check port and process conflicts")
+	failures := make(map[*node.Node][]node.CheckFailure)
+	for _, n := range c.clusterNodes {
+		nodeFailures, err := n.CheckConflicts()
+		if err != nil {
+			c.log.Errorf("fail to check conflicts on node <%s>, error: %v", n.Name(), err)
+			return err
+		}
+		failures[n] = nodeFailures
+	}
+	err := c.reportFailures(failures)
+	if err != nil && c.force {
+		c.msg.Warn("conflicts found, continue since installing is forced")
+		return nil
+	}
+	return err
+}
+
+func (c *cluster) reportFailures(failures map[*node.Node][]node.CheckFailure) error {
+	var rows [][]string
+	failedNodes := 0
+	// keep the order of nodes in table
+	for _, n := range c.clusterNodes {
+		if len(failures[n]) > 0 {
+			failedNodes++
+		}
+		for _, f := range failures[n] {
+			rows = append(rows, []string{n.Name(), f.Check, f.Expected, f.Actual})
+		}
+	}
+	if failedNodes == 0 {
+		return nil
+	}
+	c.msg.Table([]string{"NODE", "CHECK", "EXPECTED", "ACTUAL"}, rows)
+	return fmt.Errorf("preflight failed on %d node(s)", failedNodes)
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/godzilla-s/k3s-installer/pkg/config"
+	"github.com/godzilla-s/k3s-installer/pkg/node"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	redacted       = "<redacted>"
+	generatedToken = "<generated when installing>"
+)
+
+// secretKeys are the keys whose values are redacted when rendering
+var secretKeys = map[string]bool{
+	"rootPassword":   true,
+	"becomePassword": true,
+	"passphrase":     true,
+	"password":       true,
+	"token":          true,
+	"agentToken":     true,
+	"agent-token":    true,
+}
+
+// Render writes the resolved config and the files written to every node without connecting to
+// any of them, the secrets are redacted
+func Render(conf *config.Config, w io.Writer) error {
+	fmt.Fprintln(w, "# resolved config")
+	if err := writeRedacted(w, conf); err != nil {
+		return err
+	}
+
+	token, agentToken := conf.Settings.Token, conf.Settings.AgentToken
+	if token == "" {
+		token = generatedToken
+	}
+	if agentToken == "" {
+		agentToken = token
+	}
+
+	var initAddress string
+	for i, name := range conf.Settings.Cluster.Master {
+		isClusterInit := i == 0
+		if isClusterInit {
+			initAddress = conf.Nodes[name].Address
+		}
+		server := fmt.Sprintf("https://%s:6443", initAddress)
+		if err := renderNode(conf, w, name, true, isClusterInit, server, token, conf.Settings.AgentToken); err != nil {
+			return err
+		}
+	}
+	for _, name := range conf.Settings.Cluster.Worker {
+		server := fmt.Sprintf("https://%s:6443", conf.Settings.HaIP)
+		if err := renderNode(conf, w, name, false, false, server, agentToken, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renderNode(conf *config.Config, w io.Writer, name string, isMaster, isClusterInit bool, server, token, agentToken string) error {
+	k3s, registries, err := node.RenderConfig(conf, name, isMaster, isClusterInit, server, token, agentToken)
+	if err != nil {
+		return fmt.Errorf("fail to render config of node <%s>: %v", name, err)
+	}
+	fmt.Fprintf(w, "---\n# node <%s> %s: /etc/rancher/k3s/config.yaml\n", name, conf.Nodes[name].Address)
+	if err = writeRedactedYAML(w, k3s); err != nil {
+		return err
+	}
+	if registries == nil {
+		return nil
+	}
+	fmt.Fprintf(w, "---\n# node <%s> %s: /etc/rancher/k3s/registries.yaml\n", name, conf.Nodes[name].Address)
+	return writeRedactedYAML(w, registries)
+}
+
+func writeRedactedYAML(w io.Writer, data []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	return writeRedacted(w, &doc)
+}
+
+func writeRedacted(w io.Writer, v interface{}) error {
+	doc, ok := v.(*yaml.Node)
+	if !ok {
+		doc = &yaml.Node{}
+		if err := doc.Encode(v); err != nil {
+			return err
+		}
+	}
+	redact(doc)
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// redact replaces the non-empty values of secret keys
+func redact(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value := node.Content[i+1]
+			if secretKeys[node.Content[i].Value] && value.Kind == yaml.ScalarNode &&
+				value.Value != "" && value.Value != generatedToken {
+				value.Value, value.Tag, value.Style = redacted, "!!str", 0
+			}
+		}
+	}
+	for _, child := range node.Content {
+		redact(child)
+	}
+}
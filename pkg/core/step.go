@@ -18,32 +18,122 @@ type k3sStep struct {
 
 func (k *k3sStep) install() error {
 	k.msg.Step("install k3s")
+	if err := k.checkConflicts(); err != nil {
+		return err
+	}
+	err := k.each(k.clusterNodes, func(n *node.Node) error {
+		k.log.Printf("prepare node <%s>", n.Name())
+		return n.Prepare()
+	})
+	if err != nil {
+		k.log.Errorf("fail to prepare cluster nodes")
+		return err
+	}
+	// the ports are opened in firewall by Prepare
+	if err = k.checkConnectivity(); err != nil {
+		if !k.force {
+			return err
+		}
+		k.msg.Warn("%v, continue since installing is forced", err)
+	}
+
+	// the init server creates the cluster, other servers and agents join it afterwards
+	token, err := k.clusterToken()
+	if err != nil {
+		return err
+	}
+	agentToken := k.agentToken
+	if agentToken == "" {
+		agentToken = token
+	}
+	k.msg.Message("install k3s on init server <%s>", k.initNode.Name())
+	k.initNode.SetToken(token, k.agentToken)
+	if err = k.initNode.InstallK3S(); err != nil {
+		k.log.Errorf("cluster init server <%s> install failed, error: %v", k.initNode.Name(), err)
+		return fmt.Errorf("cluster installed fail")
+	}
+
+	var servers, agents []*node.Node
+	for _, n := range k.clusterNodes {
+		switch {
+		case n == k.initNode:
+		case n.IsMaster():
+			servers = append(servers, n)
+		default:
+			agents = append(agents, n)
+		}
+	}
+
+	// the ha IP may not be served before all servers are up, servers join by the init server directly
+	if len(servers) > 0 {
+		k.msg.Message("join %d servers", len(servers))
+		server := fmt.Sprintf("https://%s:6443", k.initNode.Name())
+		// embedded etcd fails to add several members at the same time, servers join one by one
+		// and InstallK3S waits for each of them to be running
+		for _, n := range servers {
+			n.JoinCluster(server, token, k.agentToken)
+			if err = n.InstallK3S(); err != nil {
+				k.log.Errorf("server <%s> fail to join cluster, error: %v", n.Name(), err)
+				return fmt.Errorf("cluster installed fail")
+			}
+		}
+	}
+
+	if len(agents) > 0 {
+		k.msg.Message("join %d agents", len(agents))
+		server := fmt.Sprintf("https://%s:6443", k.clusterIP)
+		err = k.each(agents, func(n *node.Node) error {
+			n.JoinCluster(server, agentToken, "")
+			return n.InstallK3S()
+		})
+		if err != nil {
+			k.log.Errorf("k3s cluster install failed")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// clusterToken returns the configured token, or the token of init server if k3s has been
+// running on it, otherwise a new token is generated
+func (k *k3sStep) clusterToken() (string, error) {
+	if k.token != "" {
+		return k.token, nil
+	}
+	if k.initNode.IsK3SRunning() {
+		token, err := k.initNode.ClusterToken()
+		if err != nil {
+			k.log.Errorf("fail to read cluster token from <%s>, error: %v", k.initNode.Name(), err)
+			return "", err
+		}
+		return token, nil
+	}
+	token, err := node.GenerateToken()
+	if err != nil {
+		return "", fmt.Errorf("fail to generate cluster token: %v", err)
+	}
+	return token, nil
+}
+
+// each runs fn on nodes in parallel and fails if any of them fails
+func (k *k3sStep) each(nodes []*node.Node, fn func(n *node.Node) error) error {
 	var failed atomic.Int32
-	for _, clusterNode := range k.clusterNodes {
+	for _, clusterNode := range nodes {
 		k.waitGroup.Add(1)
 		go func(n *node.Node) {
 			defer k.waitGroup.Done()
-			k.log.Printf("install k3s on <%s>", n.Name())
-			if err := n.Prepare(); err != nil {
-				k.log.Printf("cluster node <%s> fail to prepared, error: %v", n.Name(), err)
-				failed.Add(1)
-				return
-			}
-			if err := n.InstallK3S(); err != nil {
-				k.log.Printf("cluster node <%s> install failed, error: %v", n.Name(), err)
+			if err := fn(n); err != nil {
+				k.log.Printf("cluster node <%s> failed, error: %v", n.Name(), err)
 				failed.Add(1)
-				return
 			}
 		}(clusterNode)
 	}
-
 	k.waitGroup.Wait()
 
 	if failed.Load() > 0 {
-		k.log.Errorf("k3s cluster install failed")
 		return fmt.Errorf("cluster installed fail")
 	}
-
 	return nil
 }
 
@@ -60,6 +150,8 @@ func (k *k3sStep) uninstall() error {
 				return
 			}
 			if err := n.Cleanup(); err != nil {
+				k.log.Errorf("fail to clean up node <%s>: %v", n.Name(), err)
+				failed.Add(1)
 				return
 			}
 			k.log.Printf("cluster node <%s> uninstall success", n.Name())
@@ -67,8 +159,8 @@ func (k *k3sStep) uninstall() error {
 	}
 	k.waitGroup.Wait()
 	if failed.Load() > 0 {
-		k.log.Errorf("k3s cluster install failed")
-		return fmt.Errorf("cluster installed fail")
+		k.log.Errorf("k3s cluster uninstall failed")
+		return fmt.Errorf("cluster uninstalled fail")
 	}
 	return nil
 }
@@ -76,6 +168,8 @@ func (k *k3sStep) uninstall() error {
 type chartStep struct {
 	charts []*kube.Chart
 	msg    *utils.Print
+	// helmDir keeps the helm repository index and registry credentials to pull charts
+	helmDir string
 	*cluster
 }
 
@@ -83,6 +177,13 @@ func (c *chartStep) install() error {
 	c.msg.Step("install charts")
 	for _, chart := range c.charts {
 		c.msg.Message("install chart <%s>, namespace: %s", chart.ReleaseName, chart.Namespace)
+		if chart.Source != nil {
+			err := kube.PullChart(chart.Source, chart.PkgPath, c.helmDir)
+			if err != nil {
+				c.msg.Error("fail to pull chart <%s>, error: %v", chart.ReleaseName, err)
+				return err
+			}
+		}
 		err := c.installChart(chart)
 		if err != nil {
 			c.msg.Error("fail to install chart <%s>, namespace: %s, error: %v", chart.ReleaseName, chart.Namespace, err)
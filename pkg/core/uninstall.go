@@ -10,6 +10,7 @@ func Uninstall(conf *config.Config, log *logrus.Logger) error {
 	if err != nil {
 		return err
 	}
+	defer cluster.close()
 
 	for i := len(cluster.steps) - 1; i >= 0; i-- {
 		err := cluster.steps[i].uninstall()
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/godzilla-s/k3s-installer/pkg/config"
+	"github.com/godzilla-s/k3s-installer/pkg/utils"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// Validate checks the files referenced by config deeper than config.Parse, it does not connect to
+// any node. All the problems found are returned.
+func Validate(conf *config.Config) []error {
+	var errs []error
+	for _, name := range utils.SortedKeys(conf.Charts) {
+		if err := validateChart(conf.Charts[name]); err != nil {
+			errs = append(errs, fmt.Errorf("invalid chart <%s>: %v", name, err))
+		}
+	}
+	for _, name := range utils.SortedKeys(conf.Images) {
+		if err := validateImage(conf.Images[name].Path); err != nil {
+			errs = append(errs, fmt.Errorf("invalid image <%s>: %v", name, err))
+		}
+	}
+	for _, name := range utils.SortedKeys(conf.Packages) {
+		if err := validatePackage(conf.Packages[name]); err != nil {
+			errs = append(errs, fmt.Errorf("invalid package <%s>: %v", name, err))
+		}
+	}
+	return errs
+}
+
+func validateChart(chart *config.Chart) error {
+	if _, err := os.Stat(chart.Path); err != nil && chart.Repo != "" {
+		// not cached yet, it is pulled from repo when installing
+		return nil
+	}
+	ch, err := loader.LoadFile(chart.Path)
+	if err != nil {
+		return fmt.Errorf("fail to load %s: %v", chart.Path, err)
+	}
+	if ch.Metadata.Version != chart.Version {
+		return fmt.Errorf("version of %s is %s, expect %s", chart.Path, ch.Metadata.Version, chart.Version)
+	}
+	return nil
+}
+
+// validateImage checks the image file is a tarball, it may be compressed by gzip
+func validateImage(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	magic, err := r.(*bufio.Reader).Peek(2)
+	if err != nil {
+		return fmt.Errorf("fail to read %s: %v", file, err)
+	}
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("fail to read %s: %v", file, err)
+		}
+		defer gz.Close()
+		r = gz
+	} else if strings.HasSuffix(file, ".zst") {
+		// k3s accepts zstd images, the content is not checked
+		return nil
+	}
+	if _, err = tar.NewReader(r).Next(); err != nil {
+		return fmt.Errorf("%s is not a tarball: %v", file, err)
+	}
+	return nil
+}
+
+// validatePackage checks the directory of rpm or deb package contains the packages
+func validatePackage(pkg *config.Package) error {
+	var suffix string
+	switch pkg.Type {
+	case config.PackageRPM:
+		suffix = ".rpm"
+	case config.PackageDeb:
+		suffix = ".deb"
+	default:
+		return nil
+	}
+	entries, err := os.ReadDir(pkg.Path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), suffix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("no %s file found in %s", suffix, filepath.Clean(pkg.Path))
+}
@@ -1,15 +1,18 @@
 package node
 
 import (
-	"fmt"
+	"path"
+	"strings"
 
 	"github.com/godzilla-s/k3s-installer/pkg/config"
+	"gopkg.in/yaml.v3"
 )
 
 type k3sConfig struct {
 	ClusterInit            *bool    `yaml:"cluster-init,omitempty"`
 	WriteKubeConfigMode    int      `yaml:"write-kubeconfig-mode,omitempty"`
 	Token                  string   `yaml:"token,omitempty"`
+	AgentToken             string   `yaml:"agent-token,omitempty"`
 	FlannelBackend         string   `yaml:"flannel-backend,omitempty"`
 	Server                 string   `yaml:"server,omitempty"`
 	TlsSAN                 []string `yaml:"tls-san,omitempty"`
@@ -18,35 +21,87 @@ type k3sConfig struct {
 	DisableNetworkPolicy   *bool    `yaml:"disable-network-policy,omitempty"`
 	EnableDocker           *bool    `yaml:"docker,omitempty"`
 	Disable                []string `yaml:"disable,omitempty"`
+	NodeIP                 string   `yaml:"node-ip,omitempty"`
+	NodeExternalIP         string   `yaml:"node-external-ip,omitempty"`
+	FlannelIface           string   `yaml:"flannel-iface,omitempty"`
+	NodeLabels             []string `yaml:"node-label,omitempty"`
+	NodeTaints             []string `yaml:"node-taint,omitempty"`
+	KubeletArgs            []string `yaml:"kubelet-arg,omitempty"`
+	KubeApiserverArgs      []string `yaml:"kube-apiserver-arg,omitempty"`
+	// extra is merged into the config file, it overrides the fields above
+	extra map[string]interface{}
+}
+
+// marshal encodes the config file with the extra config merged
+func (kc *k3sConfig) marshal() ([]byte, error) {
+	data, err := yaml.Marshal(kc)
+	if err != nil {
+		return nil, err
+	}
+	if len(kc.extra) == 0 {
+		return data, nil
+	}
+	merged := make(map[string]interface{})
+	if err = yaml.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	for k, v := range kc.extra {
+		merged[k] = v
+	}
+	return yaml.Marshal(merged)
 }
 
 type registryConfig struct {
-	Mirrors map[string]mirror `yaml:"mirrors"`
-	Configs map[string]conf   `yaml:"configs"`
+	Mirrors map[string]mirror `yaml:"mirrors,omitempty"`
+	Configs map[string]conf   `yaml:"configs,omitempty"`
 }
 
 type mirror struct {
-	Endpoints []string `yaml:"endpoint"`
+	Endpoints []string          `yaml:"endpoint"`
+	Rewrites  map[string]string `yaml:"rewrite,omitempty"`
 }
 
 type conf struct {
-	ConfigTLS configTls `yaml:"tls"`
+	Auth      *configAuth `yaml:"auth,omitempty"`
+	ConfigTLS *configTls  `yaml:"tls,omitempty"`
+}
+
+type configAuth struct {
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
 }
 
 type configTls struct {
-	CertFile string `yaml:"cert_file"`
+	CAFile             string `yaml:"ca_file,omitempty"`
+	CertFile           string `yaml:"cert_file,omitempty"`
+	KeyFile            string `yaml:"key_file,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
 }
 
-func toConfig(isMaster bool, conf *config.Config) *k3sConfig {
-	if !isMaster {
-		return &k3sConfig{Server: fmt.Sprintf("https://%s:6443", conf.Settings.HaIP)}
-	}
+// registryFile is a local TLS file of registry which is uploaded to node
+type registryFile struct {
+	local  string
+	target string
+}
 
+func toConfig(isMaster bool, conf *config.Config, n *config.Node) *k3sConfig {
 	kc := &k3sConfig{
-		WriteKubeConfigMode: 644,
-		FlannelBackend:      "vxlan",
-		TlsSAN:              []string{conf.Settings.HaIP},
+		NodeIP:         n.K3S.NodeIP,
+		NodeExternalIP: n.K3S.NodeExternalIP,
+		FlannelIface:   n.K3S.FlannelIface,
+		NodeLabels:     n.K3S.NodeLabels,
+		NodeTaints:     n.K3S.NodeTaints,
+		KubeletArgs:    n.K3S.KubeletArgs,
+		extra:          n.K3S.ExtraConfig,
+	}
+	if !isMaster {
+		return kc
 	}
+
+	kc.WriteKubeConfigMode = 644
+	kc.FlannelBackend = "vxlan"
+	kc.TlsSAN = []string{conf.Settings.HaIP}
+	kc.KubeApiserverArgs = n.K3S.KubeApiserverArgs
 	if conf.Settings.Config.DisableFlannel {
 		kc.FlannelBackend = "none"
 	}
@@ -62,18 +117,60 @@ func toConfig(isMaster bool, conf *config.Config) *k3sConfig {
 	return kc
 }
 
-func toRegistriesConfig() *registryConfig {
+const registryCertsDir = "/etc/rancher/k3s/certs"
+
+// toRegistriesConfig converts the registries to registries.yaml of k3s, the TLS files are
+// referenced by the remote paths where they are uploaded to
+func toRegistriesConfig(registries []*config.Registry) (*registryConfig, []registryFile) {
 	rc := &registryConfig{
-		Mirrors: map[string]mirror{
-			"docker.io": {
-				Endpoints: []string{"https://dockerhub.io"},
-			},
-			"quay.io": {
-				Endpoints: []string{"https://dockerhub.io"},
-			},
-		},
+		Mirrors: make(map[string]mirror),
 		Configs: make(map[string]conf),
 	}
+	var files []registryFile
+	for _, registry := range registries {
+		host, endpoint := registry.Address, "https://"+registry.Address
+		if i := strings.Index(host, "://"); i >= 0 {
+			host, endpoint = host[i+3:], registry.Address
+		}
+		host = strings.TrimSuffix(host, "/")
 
-	return rc
+		// registries mirroring the same upstream are tried in order, their rewrites are
+		// validated to be the same
+		for _, name := range append([]string{host}, registry.Mirrors...) {
+			m, ok := rc.Mirrors[name]
+			if !ok {
+				m.Rewrites = registry.Rewrites
+			}
+			m.Endpoints = append(m.Endpoints, endpoint)
+			rc.Mirrors[name] = m
+		}
+
+		var c conf
+		if registry.Username != "" || registry.Password != "" {
+			c.Auth = &configAuth{Username: registry.Username, Password: registry.Password}
+		}
+		tls := &configTls{InsecureSkipVerify: registry.InsecureSkipVerify}
+		for _, f := range []struct {
+			local  string
+			name   string
+			remote *string
+		}{
+			{registry.CaCert, "ca.crt", &tls.CAFile},
+			{registry.Cert, "client.crt", &tls.CertFile},
+			{registry.Key, "client.key", &tls.KeyFile},
+		} {
+			if f.local == "" {
+				continue
+			}
+			*f.remote = path.Join(registryCertsDir, strings.ReplaceAll(host, ":", "_"), f.name)
+			files = append(files, registryFile{local: f.local, target: *f.remote})
+		}
+		if *tls != (configTls{}) {
+			c.ConfigTLS = tls
+		}
+		if c.Auth != nil || c.ConfigTLS != nil {
+			rc.Configs[host] = c
+		}
+	}
+	return rc, files
 }
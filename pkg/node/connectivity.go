@@ -0,0 +1,46 @@
+package node
+
+import (
+	"time"
+
+	"github.com/godzilla-s/k3s-installer/pkg/client/remote"
+)
+
+// inboundPorts returns the ports of node which are connected by other nodes,
+// etcd ports are only connected by masters
+func (n *Node) inboundPorts(fromMaster bool) []remote.Port {
+	ports := []remote.Port{{Port: "10250", Protocol: "tcp"}}
+	if n.isMaster {
+		ports = append(ports, remote.Port{Port: "6443", Protocol: "tcp"})
+		if fromMaster {
+			ports = append(ports,
+				remote.Port{Port: "2379", Protocol: "tcp"},
+				remote.Port{Port: "2380", Protocol: "tcp"},
+			)
+		}
+	}
+	if !n.settings.DisableFlannel {
+		ports = append(ports, remote.Port{Port: "8472", Protocol: "udp"})
+	}
+	return ports
+}
+
+// InboundPorts returns the ports of node which must be reachable from the given node
+func (n *Node) InboundPorts(from *Node) []remote.Port {
+	return n.inboundPorts(from.isMaster)
+}
+
+// StartProbeListeners listens on all inbound ports of node for duration, it returns the file
+// where the received probes are recorded
+func (n *Node) StartProbeListeners(duration time.Duration) (string, error) {
+	return n.remote.StartListeners(n.inboundPorts(true), duration)
+}
+
+func (n *Node) ReadProbeRecord(file string) (*remote.ListenerRecord, error) {
+	return n.remote.ReadListenerRecord(file)
+}
+
+// Probe connects the given ports of other nodes, the name of node is sent as token
+func (n *Node) Probe(targets []remote.ProbeTarget) (map[remote.ProbeTarget]error, error) {
+	return n.remote.Probe(n.Name(), targets)
+}
@@ -0,0 +1,67 @@
+package node
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/godzilla-s/k3s-installer/pkg/client/remote"
+	"github.com/godzilla-s/k3s-installer/pkg/config"
+)
+
+const (
+	defaultClusterCIDR = "10.42.0.0/16"
+	defaultServiceCIDR = "10.43.0.0/16"
+)
+
+// k3sPorts returns the inbound ports required by k3s, see
+// https://docs.k3s.io/installation/requirements#inbound-rules-for-k3s-nodes
+func (n *Node) k3sPorts() []remote.Port {
+	ports := []remote.Port{
+		{Port: "10250", Protocol: "tcp"},
+	}
+	if n.isMaster {
+		ports = append(ports,
+			remote.Port{Port: "6443", Protocol: "tcp"},
+			remote.Port{Port: "2379-2380", Protocol: "tcp"},
+		)
+	}
+	if !n.settings.DisableFlannel {
+		ports = append(ports,
+			remote.Port{Port: "8472", Protocol: "udp"},
+			remote.Port{Port: "51820-51821", Protocol: "udp"},
+		)
+	}
+	return ports
+}
+
+// k3sSources returns the pod and service CIDRs, the traffic from them must be trusted
+func (n *Node) k3sSources() []string {
+	var sources []string
+	for key, cidr := range map[string]string{"cluster-cidr": defaultClusterCIDR, "service-cidr": defaultServiceCIDR} {
+		if value, ok := n.config.extra[key].(string); ok && value != "" {
+			cidr = value
+		}
+		for _, c := range strings.Split(cidr, ",") {
+			sources = append(sources, strings.TrimSpace(c))
+		}
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+func (n *Node) configureFirewall() error {
+	switch n.firewallMode {
+	case config.FirewallManage:
+		return n.remote.OpenPorts(n.k3sPorts(), n.k3sSources())
+	case config.FirewallDisable:
+		return n.remote.StopFirewall()
+	}
+	return nil
+}
+
+func (n *Node) cleanupFirewall() error {
+	if n.firewallMode != config.FirewallManage {
+		return nil
+	}
+	return n.remote.ClosePorts(n.k3sPorts(), n.k3sSources())
+}
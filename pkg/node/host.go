@@ -0,0 +1,174 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/godzilla-s/k3s-installer/pkg/client/remote"
+	"github.com/godzilla-s/k3s-installer/pkg/utils"
+)
+
+const (
+	modulesFile = "/etc/modules-load.d/k3s-installer.conf"
+	sysctlFile  = "/etc/sysctl.d/90-k3s-installer.conf"
+	// sysctlBackup keeps the values before installing, they are restored on uninstall
+	sysctlBackup = "/var/lib/k3s-installer/sysctl.orig"
+	// fstabMarker prefixes the swap entries commented out in /etc/fstab
+	fstabMarker = "#k3s-installer#"
+)
+
+var kernelModules = []string{"overlay", "br_netfilter"}
+
+var defaultSysctls = map[string]string{
+	"net.ipv4.ip_forward":                 "1",
+	"net.ipv6.conf.all.forwarding":        "1",
+	"net.bridge.bridge-nf-call-iptables":  "1",
+	"net.bridge.bridge-nf-call-ip6tables": "1",
+	"fs.inotify.max_user_instances":       "8192",
+	"fs.inotify.max_user_watches":         "524288",
+}
+
+func (n *Node) exec(cmd string, options ...remote.CommandOption) ([]byte, error) {
+	output, err := n.remote.Exec(context.Background(), cmd, options...)
+	if err != nil {
+		return output, fmt.Errorf("%s: %v", cmd, err)
+	}
+	return output, nil
+}
+
+// prepareHost loads the kernel modules, applies sysctls and disables swap, it is safe to run again
+func (n *Node) prepareHost() error {
+	n.log.Printf("prepare host: kernel modules, sysctls and swap")
+	if err := n.loadModules(); err != nil {
+		return err
+	}
+	if err := n.applySysctls(); err != nil {
+		return err
+	}
+	return n.disableSwap()
+}
+
+// revertHost undoes prepareHost, the kernel modules are kept loaded since others may use them
+func (n *Node) revertHost() error {
+	n.log.Printf("revert host preparation")
+	if _, err := n.exec(fmt.Sprintf("rm -f %s %s", modulesFile, sysctlFile)); err != nil {
+		return err
+	}
+	if backup, err := n.remote.ReadFile(sysctlBackup); err == nil {
+		for _, line := range strings.Split(string(backup), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if _, err := n.exec(fmt.Sprintf("sysctl -w '%s'", line), remote.WithQuiet()); err != nil {
+				n.log.Warnf("fail to restore sysctl %s, error: %v", line, err)
+			}
+		}
+		if _, err := n.exec("rm -f " + sysctlBackup); err != nil {
+			return err
+		}
+	}
+	return n.enableSwap()
+}
+
+func (n *Node) loadModules() error {
+	for _, module := range kernelModules {
+		if _, err := n.exec("modprobe " + module); err != nil {
+			return err
+		}
+	}
+	data := []byte(strings.Join(kernelModules, "\n") + "\n")
+	return n.remote.WriteFile(modulesFile, data, 0644, true)
+}
+
+func (n *Node) sysctls() map[string]string {
+	sysctls := make(map[string]string, len(defaultSysctls)+len(n.userSysctls))
+	for k, v := range defaultSysctls {
+		sysctls[k] = v
+	}
+	for k, v := range n.userSysctls {
+		sysctls[k] = v
+	}
+	return sysctls
+}
+
+func (n *Node) applySysctls() error {
+	sysctls := n.sysctls()
+	keys := utils.SortedKeys(sysctls)
+
+	backup, err := n.readSysctlBackup()
+	if err != nil {
+		return err
+	}
+	// the backup keeps the values before installing, the keys added to config on a later run
+	// are merged into it with their current values
+	backupChanged := false
+	var conf bytes.Buffer
+	for _, k := range keys {
+		output, err := n.exec(fmt.Sprintf("sysctl -n '%s'", k), remote.WithQuiet())
+		if err != nil {
+			// sysctl -p fails on the unknown key, eg. ipv6 keys when ipv6 is disabled
+			n.log.Warnf("sysctl %s is not available, skip it, error: %v", k, err)
+			continue
+		}
+		if _, ok := backup[k]; !ok {
+			backup[k] = strings.TrimSpace(string(output))
+			backupChanged = true
+		}
+		fmt.Fprintf(&conf, "%s = %s\n", k, sysctls[k])
+	}
+	if backupChanged {
+		var data bytes.Buffer
+		for _, k := range utils.SortedKeys(backup) {
+			fmt.Fprintf(&data, "%s=%s\n", k, backup[k])
+		}
+		if err = n.remote.WriteFile(sysctlBackup, data.Bytes(), 0644, true); err != nil {
+			return err
+		}
+	}
+	err = n.remote.WriteFile(sysctlFile, conf.Bytes(), 0644, true)
+	if err != nil {
+		return err
+	}
+	_, err = n.exec("sysctl -p " + sysctlFile)
+	return err
+}
+
+// readSysctlBackup returns the sysctls in backup, it is empty if there is no backup yet
+func (n *Node) readSysctlBackup() (map[string]string, error) {
+	backup := make(map[string]string)
+	data, err := n.remote.ReadFile(sysctlBackup)
+	if err != nil {
+		// the original values would be lost if the backup exists but is not read
+		if _, serr := n.exec("test -e "+sysctlBackup, remote.WithQuiet()); serr == nil {
+			return nil, fmt.Errorf("fail to read %s: %v", sysctlBackup, err)
+		}
+		return backup, nil
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			backup[k] = v
+		}
+	}
+	return backup, nil
+}
+
+func (n *Node) disableSwap() error {
+	if _, err := n.exec("swapoff -a"); err != nil {
+		return err
+	}
+	// comment out the swap entries, which are restored by enableSwap
+	cmd := fmt.Sprintf(`sed -i -E 's@^([^#].*[[:space:]]swap[[:space:]].*)$@%s\1@' /etc/fstab`, fstabMarker)
+	_, err := n.exec(cmd)
+	return err
+}
+
+func (n *Node) enableSwap() error {
+	cmd := fmt.Sprintf(`sed -i -E 's@^%s@@' /etc/fstab`, fstabMarker)
+	if _, err := n.exec(cmd); err != nil {
+		return err
+	}
+	_, err := n.exec("swapon -a")
+	return err
+}
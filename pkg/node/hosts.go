@@ -0,0 +1,95 @@
+package node
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	hostsFile       = "/etc/hosts"
+	hostsBlockBegin = "# BEGIN k3s-installer managed block"
+	hostsBlockEnd   = "# END k3s-installer managed block"
+)
+
+// HostEntry is a line of /etc/hosts
+type HostEntry struct {
+	Address   string
+	Hostnames []string
+}
+
+// Hostname returns the configured hostname, or the current one if it is not configured
+func (n *Node) Hostname() string {
+	if n.hostname != "" {
+		return n.hostname
+	}
+	return n.systemInfo.Hostname
+}
+
+// SetClusterHosts sets the entries of the managed block in /etc/hosts
+func (n *Node) SetClusterHosts(entries []HostEntry) {
+	n.clusterHosts = entries
+}
+
+func (n *Node) setHostname() error {
+	if n.hostname == "" || n.hostname == n.systemInfo.Hostname {
+		return nil
+	}
+	n.log.Printf("set hostname %s, current: %s", n.hostname, n.systemInfo.Hostname)
+	if _, err := n.exec("hostnamectl set-hostname " + n.hostname); err != nil {
+		return err
+	}
+	n.systemInfo.Hostname = n.hostname
+	return nil
+}
+
+func (n *Node) updateHosts() error {
+	if !n.manageHosts {
+		return nil
+	}
+	var block []string
+	for _, entry := range n.clusterHosts {
+		block = append(block, fmt.Sprintf("%s %s", entry.Address, strings.Join(entry.Hostnames, " ")))
+	}
+	return n.writeHostsBlock(block)
+}
+
+func (n *Node) removeHosts() error {
+	if !n.manageHosts {
+		return nil
+	}
+	return n.writeHostsBlock(nil)
+}
+
+// writeHostsBlock replaces the managed block of /etc/hosts, the block is removed if lines is empty
+func (n *Node) writeHostsBlock(lines []string) error {
+	data, err := n.remote.ReadFile(hostsFile)
+	if err != nil {
+		return err
+	}
+	content := replaceBlock(string(data), lines)
+	if content == string(data) {
+		return nil
+	}
+	return n.remote.WriteFile(hostsFile, []byte(content), 0644, true)
+}
+
+func replaceBlock(content string, lines []string) string {
+	var kept []string
+	inBlock := false
+	for _, line := range strings.Split(strings.TrimRight(content, "\n"), "\n") {
+		switch {
+		case line == hostsBlockBegin:
+			inBlock = true
+		case line == hostsBlockEnd:
+			inBlock = false
+		case !inBlock:
+			kept = append(kept, line)
+		}
+	}
+	if len(lines) > 0 {
+		kept = append(kept, hostsBlockBegin)
+		kept = append(kept, lines...)
+		kept = append(kept, hostsBlockEnd)
+	}
+	return strings.Join(kept, "\n") + "\n"
+}
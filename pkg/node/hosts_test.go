@@ -0,0 +1,51 @@
+package node
+
+import "testing"
+
+func TestReplaceBlock(t *testing.T) {
+	const (
+		begin = hostsBlockBegin + "\n"
+		end   = hostsBlockEnd + "\n"
+	)
+	tests := []struct {
+		name    string
+		content string
+		lines   []string
+		want    string
+	}{
+		{
+			name:    "append block",
+			content: "127.0.0.1 localhost\n",
+			lines:   []string{"10.0.0.1 node1"},
+			want:    "127.0.0.1 localhost\n" + begin + "10.0.0.1 node1\n" + end,
+		},
+		{
+			name:    "no trailing newline",
+			content: "127.0.0.1 localhost",
+			lines:   []string{"10.0.0.1 node1"},
+			want:    "127.0.0.1 localhost\n" + begin + "10.0.0.1 node1\n" + end,
+		},
+		{
+			name:    "replace block",
+			content: "127.0.0.1 localhost\n" + begin + "10.0.0.1 old\n" + end + "10.0.0.9 other\n",
+			lines:   []string{"10.0.0.1 node1", "10.0.0.2 node2"},
+			want:    "127.0.0.1 localhost\n10.0.0.9 other\n" + begin + "10.0.0.1 node1\n10.0.0.2 node2\n" + end,
+		},
+		{
+			name:    "remove block",
+			content: "127.0.0.1 localhost\n" + begin + "10.0.0.1 node1\n" + end,
+			want:    "127.0.0.1 localhost\n",
+		},
+		{
+			name:    "idempotent",
+			content: "127.0.0.1 localhost\n" + begin + "10.0.0.1 node1\n" + end,
+			lines:   []string{"10.0.0.1 node1"},
+			want:    "127.0.0.1 localhost\n" + begin + "10.0.0.1 node1\n" + end,
+		},
+	}
+	for _, tt := range tests {
+		if got := replaceBlock(tt.content, tt.lines); got != tt.want {
+			t.Errorf("%s: replaceBlock() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
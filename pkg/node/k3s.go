@@ -1,7 +1,11 @@
 package node
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/godzilla-s/k3s-installer/pkg/client/remote"
@@ -10,18 +14,35 @@ import (
 	"github.com/godzilla-s/k3s-installer/pkg/utils"
 )
 
+// InstallK3S installs k3s on node, the join settings must be set by JoinCluster before
+// if the node is not the cluster init server
 func (n *Node) InstallK3S() error {
-	if n.isClusterInit {
-		return n.initCluster()
-	}
-
 	err := n.remote.IsK3SRunning(n.isMaster)
 	if err == nil {
-		n.log.Printf("k3s is running, continue to next")
-		return nil
+		changed, err := n.syncRegistries()
+		if err != nil {
+			n.log.Errorf("fail to write registries config: %v", err)
+			return err
+		}
+		if !changed {
+			n.log.Printf("k3s is running, continue to next")
+			return nil
+		}
+		n.log.Printf("registries config changed, restart k3s")
+		err = n.remote.RestartK3S(n.isMaster)
+		if err != nil {
+			return err
+		}
+		return utils.Clock(2*time.Minute, 2*time.Second, func() error {
+			return n.remote.IsK3SRunning(n.isMaster)
+		})
 	}
 
 	if err == remote.ErrK3SNotRunning {
+		if _, err = n.syncRegistries(); err != nil {
+			n.log.Errorf("fail to write registries config: %v", err)
+			return err
+		}
 		err = n.remote.RestartK3S(n.isMaster)
 		if err != nil {
 			return err
@@ -36,6 +57,10 @@ func (n *Node) InstallK3S() error {
 		return nil
 	}
 
+	if !n.isClusterInit && (n.config.Server == "" || n.config.Token == "") {
+		return fmt.Errorf("missing server or token to join cluster")
+	}
+
 	// prepare k3s config
 	err = n.writeConfig()
 	if err != nil {
@@ -44,7 +69,7 @@ func (n *Node) InstallK3S() error {
 	}
 
 	// prepare k3s private registry
-	err = n.writeRegistryConfig()
+	_, err = n.syncRegistries()
 	if err != nil {
 		n.log.Errorf("fail to write registries config: %v", err)
 		return err
@@ -66,60 +91,45 @@ func (n *Node) InstallK3S() error {
 	return nil
 }
 
-func (n *Node) initCluster() error {
-	err := n.isK3SRunning()
-	if err == nil {
-		// get token if k3s is running
-		token := n.getClusterToken()
-		if token == "" {
-			return fmt.Errorf("missing cluster token")
-		}
-		setToken(token)
-		return nil
+// SetToken sets the token of cluster init server, it is used to create the cluster
+func (n *Node) SetToken(token, agentToken string) {
+	n.config.Token = token
+	if n.isMaster {
+		n.config.AgentToken = agentToken
 	}
+}
 
-	if err == remote.ErrK3SNotRunning {
-		err = n.remote.RestartK3S(n.isMaster)
-		if err != nil {
-			return err
-		}
-		err = utils.Clock(2*time.Minute, 2*time.Second, func() error {
-			return n.remote.IsK3SRunning(n.isMaster)
-		})
-		if err != nil {
-			n.log.Errorf("wait for k3s running timeout, error: %v", err)
-			return err
-		}
-		return nil
-	}
+// JoinCluster sets the server and token to join an existing cluster
+func (n *Node) JoinCluster(server, token, agentToken string) {
+	n.config.Server = server
+	n.SetToken(token, agentToken)
+}
 
-	// prepare k3s config
-	err = n.writeConfig()
-	if err != nil {
-		n.log.Errorf("fail to prepare k3s config: %v", err)
-		return err
-	}
+// IsClusterInit tells whether the node is the first server which creates the cluster
+func (n *Node) IsClusterInit() bool {
+	return n.isClusterInit
+}
 
-	// prepare k3s private registry
-	err = n.writeRegistryConfig()
-	if err != nil {
-		n.log.Errorf("fail to write registries config: %v", err)
-		return err
-	}
+func (n *Node) IsMaster() bool {
+	return n.isMaster
+}
 
-	err = n.remote.InstallK3S(n.isMaster)
-	if err != nil {
-		n.log.Errorf("fail to install k3s")
-		return err
-	}
+// IsK3SRunning tells whether k3s has been running on node
+func (n *Node) IsK3SRunning() bool {
+	return n.isK3SRunning() == nil
+}
 
-	err = utils.Clock(2*time.Minute, 3*time.Second, func() error {
-		return n.isK3SRunning()
-	})
+// ClusterToken reads the token of a running server
+func (n *Node) ClusterToken() (string, error) {
+	data, err := n.remote.ReadFile("/var/lib/rancher/k3s/server/token")
 	if err != nil {
-		return fmt.Errorf("timeout for waiting k3s running")
+		return "", err
 	}
-	return nil
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("empty cluster token")
+	}
+	return token, nil
 }
 
 func (n *Node) UninstallK3S() error {
@@ -141,31 +151,74 @@ func (n *Node) UninstallK3S() error {
 }
 
 func (n *Node) writeConfig() error {
+	data, err := n.renderConfig()
+	if err != nil {
+		return err
+	}
+	// it holds the token
+	return n.remote.WriteFile("/etc/rancher/k3s/config.yaml", data, 0600, true)
+}
+
+// renderConfig returns the content of /etc/rancher/k3s/config.yaml
+func (n *Node) renderConfig() ([]byte, error) {
 	if n.isClusterInit {
 		clusterInit := true
 		n.config.ClusterInit = &clusterInit
 	}
-	data, err := yaml.Marshal(n.config)
-	if err != nil {
-		return err
-	}
-	return n.remote.WriteFile("/etc/rancher/k3s/config.yaml", data, true)
+	return n.config.marshal()
 }
 
-func (n *Node) writeRegistryConfig() error {
+const registriesFile = "/etc/rancher/k3s/registries.yaml"
+
+// syncRegistries uploads the registry TLS files and writes registries.yaml, it tells whether
+// any of them is changed, k3s must be restarted to reload them
+func (n *Node) syncRegistries() (bool, error) {
+	if len(n.registries.Mirrors) == 0 {
+		return n.removeRegistries()
+	}
+	changed := false
+	for _, f := range n.registryFiles {
+		data, err := os.ReadFile(f.local)
+		if err != nil {
+			return false, err
+		}
+		if old, err := n.remote.ReadFile(f.target); err == nil && bytes.Equal(old, data) {
+			continue
+		}
+		if err = n.remote.CopyFile(f.local, f.target, true); err != nil {
+			return false, fmt.Errorf("fail to upload %s: %v", f.local, err)
+		}
+		changed = true
+	}
+
 	data, err := yaml.Marshal(n.registries)
 	if err != nil {
-		return err
+		return false, err
 	}
-	return n.remote.WriteFile("/etc/rancher/k3s/registries.yaml", data, true)
+	if old, err := n.remote.ReadFile(registriesFile); err == nil && bytes.Equal(old, data) {
+		return changed, nil
+	}
+	// it holds the registry passwords
+	if err = n.remote.WriteFile(registriesFile, data, 0600, true); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
-func (n *Node) getClusterToken() string {
-	data, err := n.remote.ReadFile("/var/lib/rancher/k3s/server/token")
+// removeRegistries removes registries.yaml and the TLS files left by the registries removed
+// from config, it tells whether registries.yaml existed
+func (n *Node) removeRegistries() (bool, error) {
+	err := n.remote.Remove(registriesFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
 	if err != nil {
-		return ""
+		return false, fmt.Errorf("fail to remove %s: %v", registriesFile, err)
+	}
+	if err = n.remote.Remove(registryCertsDir); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return true, fmt.Errorf("fail to remove %s: %v", registryCertsDir, err)
 	}
-	return string(data)
+	return true, nil
 }
 
 func (n *Node) installK3S() error {
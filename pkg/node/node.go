@@ -21,22 +21,60 @@ type Node struct {
 	log           *logrus.Entry
 	config        *k3sConfig
 	registries    *registryConfig
+	registryFiles []registryFile
+	firewallMode  string
+	settings      config.K3SConfig
+	requirement   config.Requirement
+	userSysctls   map[string]string
+	hostname      string
+	manageHosts   bool
+	clusterHosts  []HostEntry
 }
 
 func New(n *config.Node, conf *config.Config, isMaster, isClusterInti bool, log *logrus.Logger) (*Node, error) {
 	logEntry := logrus.NewEntry(log).WithFields(map[string]interface{}{
 		"host": n.Address,
 	})
+	hostKey := func(fingerprint string) *remote.HostKeyConfig {
+		return &remote.HostKeyConfig{
+			KnownHosts:          conf.Settings.SSH.KnownHosts,
+			WorkspaceKnownHosts: filepath.Join(conf.Settings.RootPath, config.WorkspaceDir, "known_hosts"),
+			Fingerprint:         fingerprint,
+			TOFU:                conf.Settings.SSH.HostKeyPolicy == config.HostKeyPolicyTOFU,
+			Insecure:            conf.Settings.SSH.InsecureSkipHostKey,
+		}
+	}
+	var bastions []*remote.Config
+	for _, b := range n.Bastion {
+		bastions = append(bastions, &remote.Config{
+			Address:    fmt.Sprintf("%s:%d", b.Address, b.SSHPort),
+			User:       b.User,
+			Password:   b.Password,
+			PrivateKey: b.PrivateKey,
+			Passphrase: b.Passphrase,
+			UseAgent:   b.UseAgent != nil && *b.UseAgent,
+			HostKey:    hostKey(b.HostKey),
+		})
+	}
 	remoteCli, err := remote.New(&remote.Config{
-		Address:  fmt.Sprintf("%s:%d", n.Address, n.SSHPort),
-		User:     "root",
-		Password: n.RootPassword,
+		Address:        fmt.Sprintf("%s:%d", n.Address, n.SSHPort),
+		User:           n.User,
+		Password:       n.RootPassword,
+		PrivateKey:     n.PrivateKey,
+		Passphrase:     n.Passphrase,
+		UseAgent:       n.UseAgent != nil && *n.UseAgent,
+		Become:         n.Become != nil && *n.Become,
+		BecomePassword: n.BecomePassword,
+		HostKey:        hostKey(n.HostKey),
+		Bastions:       bastions,
+		OS:             n.OS,
 	}, logEntry)
 	if err != nil {
 		return nil, err
 	}
 	systemInfo, err := remoteCli.GetSystemInfo()
 	if err != nil {
+		remoteCli.Close()
 		return nil, err
 	}
 
@@ -45,11 +83,17 @@ func New(n *config.Node, conf *config.Config, isMaster, isClusterInti bool, log
 		remote:        remoteCli,
 		systemInfo:    systemInfo,
 		log:           logEntry,
-		config:        toConfig(isMaster, conf),
+		config:        toConfig(isMaster, conf, n),
 		isMaster:      isMaster,
 		isClusterInit: isClusterInti,
-		registries:    toRegistriesConfig(),
+		firewallMode:  conf.Settings.Firewall.Mode,
+		requirement:   n.Requirement,
+		userSysctls:   n.Sysctls,
+		hostname:      n.Hostname,
+		manageHosts:   conf.Settings.Hosts.Manage,
+		settings:      conf.Settings.Config,
 	}
+	node.registries, node.registryFiles = toRegistriesConfig(conf.Settings.Registries)
 	for _, imgName := range n.PreloadImages {
 		img := conf.Images[imgName]
 		node.preloadImages = append(node.preloadImages, loadImage{path: img.Path})
@@ -72,21 +116,49 @@ func (n *Node) SetClusterInit() {
 }
 
 func (n *Node) Prepare() error {
+	if err := n.setHostname(); err != nil {
+		n.log.Errorf("fail to set hostname, error: %v", err)
+		return err
+	}
+	if err := n.updateHosts(); err != nil {
+		n.log.Errorf("fail to update %s, error: %v", hostsFile, err)
+		return err
+	}
+	if err := n.prepareHost(); err != nil {
+		n.log.Errorf("fail to prepare host, error: %v", err)
+		return err
+	}
 	if err := n.installPackages(); err != nil {
 		return err
 	}
 	if err := n.loadImages(); err != nil {
 		return err
 	}
+	if err := n.configureFirewall(); err != nil {
+		n.log.Errorf("fail to configure firewall, error: %v", err)
+		return err
+	}
 	return nil
 }
 
-func (n *Node) Cleanup() error {
-	return nil
+// Close closes the connection to the node
+func (n *Node) Close() error {
+	return n.remote.Close()
 }
 
-func (n *Node) checkSystem() error {
-
+func (n *Node) Cleanup() error {
+	if err := n.cleanupFirewall(); err != nil {
+		n.log.Errorf("fail to cleanup firewall, error: %v", err)
+		return err
+	}
+	if err := n.revertHost(); err != nil {
+		n.log.Errorf("fail to revert host preparation, error: %v", err)
+		return err
+	}
+	if err := n.removeHosts(); err != nil {
+		n.log.Errorf("fail to cleanup %s, error: %v", hostsFile, err)
+		return err
+	}
 	return nil
 }
 
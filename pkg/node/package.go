@@ -28,6 +28,8 @@ func toPackage(name string, pkg *config.Package, node *Node) Package {
 		return &directory{name: name, localPath: pkg.Path, targetPath: pkg.TargetPath, Node: node}
 	case config.PackageRPM:
 		return &rpm{name: name, localPath: pkg.Path, Node: node}
+	case config.PackageDeb:
+		return &deb{name: name, localPath: pkg.Path, Node: node}
 	case config.PackageKernel:
 		return &kernel{name: name, localPath: pkg.Path, Node: node}
 	default:
@@ -54,7 +56,7 @@ func (b *file) install() error {
 }
 
 func (b *file) uninstall() error {
-	b.log.Println("uninstall binary <%s>", b.name)
+	b.log.Printf("uninstall binary <%s>", b.name)
 	return b.remote.Remove(b.localPath)
 }
 
@@ -129,7 +131,43 @@ func (r *rpm) uninstall() error {
 	return nil
 }
 
-type deb struct{}
+type deb struct {
+	name      string
+	localPath string
+	*Node
+}
+
+func (d *deb) install() error {
+	d.log.Printf("install deb <%s>", d.name)
+	targetPath := filepath.Join("/tmp", d.name)
+	err := d.remote.Copy(d.localPath, targetPath, true)
+	if err != nil {
+		return err
+	}
+
+	defer d.remote.Remove(targetPath)
+
+	return d.remote.Install(targetPath)
+}
+
+func (d *deb) uninstall() error {
+	d.log.Printf("uninstall deb <%s>", d.name)
+	dirEntries, err := os.ReadDir(d.localPath)
+	if err != nil {
+		return err
+	}
+
+	var debs []string
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() || !strings.HasSuffix(dirEntry.Name(), ".deb") {
+			continue
+		}
+		// deb file is named as <package>_<version>_<arch>.deb
+		pkgName, _, _ := strings.Cut(dirEntry.Name(), "_")
+		debs = append(debs, strings.TrimSuffix(pkgName, ".deb"))
+	}
+	return d.remote.Uninstall(debs)
+}
 
 type kernel struct {
 	name      string
@@ -0,0 +1,138 @@
+package node
+
+import (
+	"fmt"
+
+	"github.com/godzilla-s/k3s-installer/pkg/utils"
+)
+
+// CheckFailure is a preflight check which is not passed by node
+type CheckFailure struct {
+	Check    string
+	Expected string
+	Actual   string
+}
+
+// memoryTolerance allows the memory reserved by kernel and firmware, a 4Gi vm usually reports 3.7Gi
+const memoryTolerance = 0.9
+
+// CheckRequirement compares the system of node with its requirement
+func (n *Node) CheckRequirement() []CheckFailure {
+	var failures []CheckFailure
+	req := n.requirement
+	info := n.systemInfo
+
+	if req.CPU > 0 && info.NumberCPU < req.CPU {
+		failures = append(failures, CheckFailure{
+			Check:    "cpu",
+			Expected: fmt.Sprintf(">= %d", req.CPU),
+			Actual:   fmt.Sprintf("%d", info.NumberCPU),
+		})
+	}
+	if req.Memory != "" {
+		memory, _ := utils.ParseCapacity(req.Memory)
+		if float64(info.Memory.Bytes()) < float64(memory.Bytes())*memoryTolerance {
+			failures = append(failures, CheckFailure{
+				Check:    "memory",
+				Expected: ">= " + memory.String(),
+				Actual:   info.Memory.String(),
+			})
+		}
+	}
+	if req.Storage != "" {
+		storage, _ := utils.ParseCapacity(req.Storage)
+		if info.Storage.Bytes() < storage.Bytes() {
+			failures = append(failures, CheckFailure{
+				Check:    "storage",
+				Expected: ">= " + storage.String() + " free",
+				Actual:   info.Storage.String(),
+			})
+		}
+	}
+	if req.KernelVersion != "" {
+		kernel, _ := utils.ParseKernelVersion(req.KernelVersion)
+		if info.KernelVersion.Less(kernel) {
+			failures = append(failures, CheckFailure{
+				Check:    "kernel",
+				Expected: ">= " + req.KernelVersion,
+				Actual:   info.KernelVersion.String(),
+			})
+		}
+	}
+	return failures
+}
+
+// k3sProcesses own the ports of k3s when it has been installed, they are not conflicts
+var k3sProcesses = map[string]struct{}{
+	"k3s":        {},
+	"k3s-server": {},
+	"k3s-agent":  {},
+	"containerd": {},
+}
+
+// conflictProcesses are the runtimes which cannot run together with k3s
+var conflictProcesses = []string{"dockerd", "kubelet", "kube-apiserver", "etcd", "rke2", "rke2-server", "rke2-agent"}
+
+// CheckConflicts finds the ports used by k3s which are bound by other processes,
+// and the running runtimes which conflict with k3s
+func (n *Node) CheckConflicts() ([]CheckFailure, error) {
+	type port struct {
+		protocol string
+		port     int
+	}
+	ports := []port{{"tcp", 10250}}
+	if n.isMaster {
+		ports = append(ports, port{"tcp", 6443}, port{"tcp", 2379}, port{"tcp", 2380})
+	}
+	if !n.settings.DisableFlannel {
+		ports = append(ports, port{"udp", 8472})
+	}
+	if !n.settings.DisableTraefik || !n.settings.DisableServiceLB {
+		ports = append(ports, port{"tcp", 80}, port{"tcp", 443})
+	}
+
+	listeners, err := n.remote.Listeners()
+	if err != nil {
+		return nil, fmt.Errorf("fail to list listening ports: %v", err)
+	}
+	k3sRunning := n.isK3SRunning() == nil
+
+	var failures []CheckFailure
+	for _, p := range ports {
+		for _, l := range listeners {
+			if l.Port != p.port || l.Protocol != p.protocol {
+				continue
+			}
+			if _, ok := k3sProcesses[l.Process]; ok {
+				continue
+			}
+			owner := fmt.Sprintf("%s (pid %d)", l.Process, l.PID)
+			if l.Process == "" {
+				// sockets of kernel like vxlan have no process, it is flannel of k3s if k3s is running
+				if k3sRunning {
+					continue
+				}
+				owner = "kernel"
+			}
+			failures = append(failures, CheckFailure{
+				Check:    fmt.Sprintf("port %d/%s", p.port, p.protocol),
+				Expected: "free",
+				Actual:   "used by " + owner,
+			})
+			break
+		}
+	}
+
+	processes, err := n.remote.FindProcesses(conflictProcesses)
+	if err != nil {
+		return nil, fmt.Errorf("fail to list processes: %v", err)
+	}
+	for _, p := range processes {
+		failures = append(failures, CheckFailure{
+			Check:    "process",
+			Expected: "no " + p.Name,
+			Actual:   fmt.Sprintf("%s running (pid %d)", p.Name, p.PID),
+		})
+	}
+	return failures, nil
+}
@@ -0,0 +1,37 @@
+package node
+
+import (
+	"github.com/godzilla-s/k3s-installer/pkg/config"
+	"gopkg.in/yaml.v3"
+)
+
+// RenderConfig returns /etc/rancher/k3s/config.yaml and registries.yaml which are written to the
+// node without connecting to it, registries is nil if no registry is configured.
+// server and token are the join settings like JoinCluster, server is empty for the cluster init server.
+func RenderConfig(conf *config.Config, name string, isMaster, isClusterInit bool, server, token, agentToken string) (k3s, registries []byte, err error) {
+	n := &Node{
+		address:       conf.Nodes[name].Address,
+		isMaster:      isMaster,
+		isClusterInit: isClusterInit,
+		config:        toConfig(isMaster, conf, conf.Nodes[name]),
+	}
+	n.registries, _ = toRegistriesConfig(conf.Settings.Registries)
+	if isClusterInit {
+		n.SetToken(token, agentToken)
+	} else {
+		n.JoinCluster(server, token, agentToken)
+	}
+
+	k3s, err = n.renderConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(n.registries.Mirrors) == 0 {
+		return k3s, nil, nil
+	}
+	registries, err = yaml.Marshal(n.registries)
+	if err != nil {
+		return nil, nil, err
+	}
+	return k3s, registries, nil
+}
@@ -1,20 +1,15 @@
 package node
 
-import "sync"
-
-type clusterToken struct {
-	token string
-	sync.Once
-}
-
-var token clusterToken
-
-func setToken(tokenstr string) {
-	token.Do(func() {
-		token.token = tokenstr
-	})
-}
-
-func getToken() string {
-	return token.token
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// GenerateToken returns a random token for a new cluster
+func GenerateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
 }
@@ -1,33 +1,141 @@
 package utils
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 )
 
 type KernelVersion struct {
-	Min int
-	Max int
+	Major int
+	Minor int
+	Patch int
+}
+
+// ParseKernelVersion parses the version like 5.4, 3.10.0-1160.el7.x86_64 or 5.15.0-76-generic,
+// only major.minor.patch is kept so the components after them like 5.10.102.1-microsoft are ignored
+func ParseKernelVersion(s string) (KernelVersion, error) {
+	var kv KernelVersion
+	version := strings.TrimSpace(s)
+	if i := strings.IndexAny(version, "-+_ "); i >= 0 {
+		version = version[:i]
+	}
+	if version == "" {
+		return kv, fmt.Errorf("invalid kernel version '%s'", s)
+	}
+	parts := strings.Split(version, ".")
+	if len(parts) > 3 {
+		parts = parts[:3]
+	}
+	nums := []*int{&kv.Major, &kv.Minor, &kv.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return kv, fmt.Errorf("invalid kernel version '%s'", s)
+		}
+		*nums[i] = n
+	}
+	return kv, nil
+}
+
+// Less tells whether kv is older than other
+func (kv KernelVersion) Less(other KernelVersion) bool {
+	if kv.Major != other.Major {
+		return kv.Major < other.Major
+	}
+	if kv.Minor != other.Minor {
+		return kv.Minor < other.Minor
+	}
+	return kv.Patch < other.Patch
+}
+
+func (kv KernelVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", kv.Major, kv.Minor, kv.Patch)
 }
 
 type Unit string
 
-const ()
+const (
+	Byte Unit = ""
+	Ki   Unit = "Ki"
+	Mi   Unit = "Mi"
+	Gi   Unit = "Gi"
+	Ti   Unit = "Ti"
+	KB   Unit = "KB"
+	MB   Unit = "MB"
+	GB   Unit = "GB"
+	TB   Unit = "TB"
+)
+
+var unitBytes = map[Unit]float64{
+	Byte: 1,
+	Ki:   1 << 10,
+	Mi:   1 << 20,
+	Gi:   1 << 30,
+	Ti:   1 << 40,
+	KB:   1e3,
+	MB:   1e6,
+	GB:   1e9,
+	TB:   1e12,
+}
 
+// Capacity is a size of memory or storage in bytes
 type Capacity struct {
-	size float32
-	unit Unit
+	bytes int64
+}
+
+func NewCapacity(bytes int64) Capacity {
+	return Capacity{bytes: bytes}
 }
 
+// ParseCapacity parses the size like 512Mi, 4Gi, 50GB, 1.5T or 1024 (bytes)
 func ParseCapacity(s string) (Capacity, error) {
-	switch {
-	case strings.HasSuffix(s, "Gi"), strings.HasSuffix(s, "GB"):
-		size, err := strconv.ParseFloat(strings.TrimRight(s, "Gi"), 0)
-		if err != nil {
-			return Capacity{}, err
-		}
-		return Capacity{size: float32(size), unit: "Gi"}, nil
+	value := strings.TrimSpace(s)
+	i := strings.IndexFunc(value, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	number, suffix := value, ""
+	if i >= 0 {
+		number, suffix = value[:i], strings.TrimSpace(value[i:])
+	}
+
+	unit := Unit(suffix)
+	switch strings.ToUpper(suffix) {
+	case "K":
+		unit = Ki
+	case "M":
+		unit = Mi
+	case "G":
+		unit = Gi
+	case "T":
+		unit = Ti
+	case "B":
+		unit = Byte
+	}
+	multiple, ok := unitBytes[unit]
+	if !ok {
+		return Capacity{}, fmt.Errorf("invalid capacity '%s': unknown unit '%s'", s, suffix)
 	}
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return Capacity{}, fmt.Errorf("invalid capacity '%s'", s)
+	}
+	return Capacity{bytes: int64(size * multiple)}, nil
+}
+
+func (c Capacity) Bytes() int64 {
+	return c.bytes
+}
 
-	return Capacity{}, nil
+func (c Capacity) IsZero() bool {
+	return c.bytes == 0
+}
+
+func (c Capacity) String() string {
+	for _, unit := range []Unit{Ti, Gi, Mi, Ki} {
+		if float64(c.bytes) >= unitBytes[unit] {
+			return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(c.bytes)/unitBytes[unit]), ".0") + string(unit)
+		}
+	}
+	return strconv.FormatInt(c.bytes, 10)
 }
@@ -0,0 +1,94 @@
+package utils
+
+import "testing"
+
+func TestParseKernelVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    KernelVersion
+		wantErr bool
+	}{
+		{version: "5.4", want: KernelVersion{Major: 5, Minor: 4}},
+		{version: "3.10.0-1160.el7.x86_64\n", want: KernelVersion{Major: 3, Minor: 10}},
+		{version: "5.15.0-76-generic", want: KernelVersion{Major: 5, Minor: 15}},
+		{version: "6.1.0+", want: KernelVersion{Major: 6, Minor: 1}},
+		{version: "5.10.102.1-microsoft-standard-WSL2", want: KernelVersion{Major: 5, Minor: 10, Patch: 102}},
+		{version: "", wantErr: true},
+		{version: "five", wantErr: true},
+		{version: "5.x", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseKernelVersion(tt.version)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseKernelVersion(%q) error = %v, wantErr %v", tt.version, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseKernelVersion(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestKernelVersionLess(t *testing.T) {
+	tests := []struct {
+		a, b KernelVersion
+		want bool
+	}{
+		{a: KernelVersion{3, 10, 0}, b: KernelVersion{4, 0, 0}, want: true},
+		{a: KernelVersion{5, 4, 0}, b: KernelVersion{5, 10, 0}, want: true},
+		{a: KernelVersion{5, 10, 1}, b: KernelVersion{5, 10, 0}, want: false},
+		{a: KernelVersion{5, 10, 0}, b: KernelVersion{5, 10, 0}, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Less(tt.b); got != tt.want {
+			t.Errorf("%v.Less(%v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestParseCapacity(t *testing.T) {
+	tests := []struct {
+		capacity string
+		want     int64
+		wantErr  bool
+	}{
+		{capacity: "1024", want: 1024},
+		{capacity: "512Mi", want: 512 << 20},
+		{capacity: "4Gi", want: 4 << 30},
+		{capacity: "4g", want: 4 << 30},
+		{capacity: "1.5T", want: 3 << 39},
+		{capacity: "50GB", want: 50e9},
+		{capacity: " 2 Ki ", want: 2048},
+		{capacity: "10B", want: 10},
+		{capacity: "4Gb", wantErr: true},
+		{capacity: "Gi", wantErr: true},
+		{capacity: "1.2.3Gi", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCapacity(tt.capacity)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCapacity(%q) error = %v, wantErr %v", tt.capacity, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got.Bytes() != tt.want {
+			t.Errorf("ParseCapacity(%q) = %d, want %d", tt.capacity, got.Bytes(), tt.want)
+		}
+	}
+}
+
+func TestCapacityString(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		want  string
+	}{
+		{bytes: 512, want: "512"},
+		{bytes: 2048, want: "2Ki"},
+		{bytes: 3 << 29, want: "1.5Gi"},
+		{bytes: 4 << 40, want: "4Ti"},
+	}
+	for _, tt := range tests {
+		if got := NewCapacity(tt.bytes).String(); got != tt.want {
+			t.Errorf("NewCapacity(%d).String() = %s, want %s", tt.bytes, got, tt.want)
+		}
+	}
+}
@@ -3,8 +3,10 @@ package utils
 import (
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"text/tabwriter"
 )
 
 type Print struct {
@@ -29,6 +31,17 @@ func (p *Print) Error(format string, v ...any) {
 	fmt.Fprintln(os.Stdout, fmt.Sprintf("==> %s", fmt.Sprintf(format, v...)))
 }
 
+func (p *Print) Table(headers []string, rows [][]string) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
+
 func (p *Print) Warn(format string, v ...any) {
 	fmt.Fprintln(os.Stdout, fmt.Sprintf("==> %s", fmt.Sprintf(format, v...)))
 }
@@ -0,0 +1,13 @@
+package utils
+
+import "sort"
+
+// SortedKeys returns the keys of m in order, so the maps are walked in the same order every time
+func SortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}